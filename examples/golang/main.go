@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -248,7 +247,16 @@ func (m *Golang) LocalstackEphemeral(ctx context.Context, authToken *dagger.Secr
 	fmt.Println("Instance created")
 
 	// Wait for instance to be ready
-	time.Sleep(15 * time.Second)
+	result, err = dag.Localstack().Ephemeral(ctx, authToken, "wait", dagger.LocalstackEphemeralOpts{
+		Name: "test-dagger-example-instance",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to wait for ephemeral instance: %w", err)
+	}
+	if strings.HasPrefix(result, "Error") {
+		return "", fmt.Errorf("failed to wait for ephemeral instance: %s", result)
+	}
+	fmt.Printf("Instance running at %s\n", result)
 
 	// List instances
 	result, err = dag.Localstack().Ephemeral(ctx, authToken, "list", dagger.LocalstackEphemeralOpts{})
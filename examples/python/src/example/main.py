@@ -1,7 +1,6 @@
 import dagger
 from dagger import dag, function, object_type
 import boto3
-import time
 
 @object_type
 class Example:
@@ -120,7 +119,13 @@ class Example:
             )
             
             # Wait for instance to be ready
-            time.sleep(15)
+            endpoint_url = await dag.localstack().ephemeral(
+                auth_token=auth_token,
+                operation="wait",
+                name="test-dagger-example-instance",
+            )
+            if endpoint_url.startswith("Error"):
+                raise Exception(endpoint_url)
 
             print("Instance created")
             
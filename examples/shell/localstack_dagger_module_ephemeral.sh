@@ -19,7 +19,11 @@ dagger -m github.com/localstack/localstack-dagger-module \
 
 # Wait for instance to be ready
 echo "Waiting for instance to be ready..."
-sleep 15
+dagger -m github.com/localstack/localstack-dagger-module \
+    call ephemeral \
+    --auth-token=env:LOCALSTACK_AUTH_TOKEN \
+    --operation=wait \
+    --name=my-temp-instance
 
 # List all active ephemeral instances
 echo "Listing all active ephemeral instances..."
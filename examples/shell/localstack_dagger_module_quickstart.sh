@@ -16,7 +16,9 @@ dagger -m github.com/localstack/localstack-dagger-module \
 
 # Wait for LocalStack to be ready
 echo "Waiting for LocalStack to be ready..."
-sleep 5
+dagger -m github.com/localstack/localstack-dagger-module \
+    call wait-for-services \
+    --services=s3
 
 # Test the deployment by checking LocalStack health
 curl http://localhost:4566/_localstack/health
@@ -18,8 +18,11 @@ dagger -m github.com/localstack/localstack-dagger-module \
     --auth-token=env:LOCALSTACK_AUTH_TOKEN \
     up
 
+# Wait for LocalStack to be ready
 echo "Waiting for LocalStack to be ready..."
-sleep 5
+dagger -m github.com/localstack/localstack-dagger-module \
+    call wait-for-services \
+    --services=s3
 
 # Create a test S3 bucket using AWS CLI
 aws --endpoint-url=http://localhost:4566 s3 mb s3://my-test-bucket
@@ -183,7 +183,16 @@ export class Example {
       console.log("Instance created")
 
       // Wait for instance to be ready
-      await new Promise(resolve => setTimeout(resolve, 15000))
+      const endpointUrl = await client.localstack().ephemeral(
+        authToken,
+        "wait",
+        {
+          name: "test-dagger-example-instance"
+        }
+      )
+      if (endpointUrl.startsWith("Error")) {
+        throw new Error(endpointUrl)
+      }
 
       // List instances
       const listResponse = await client.localstack().ephemeral(
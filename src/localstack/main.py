@@ -1,68 +1,2769 @@
 import os
+import re
+import asyncio
 import dagger
-from dagger import dag, function, object_type, Doc
+from dagger import dag, field, function, object_type, Doc
 from typing import Optional, Annotated
 import base64
+import time
 from datetime import datetime
+from urllib.parse import urlparse
 import requests
 import json
+import io
+import zipfile
+import zlib
+import uuid
+import hashlib
+
+# Valid Docker image tag, see https://docs.docker.com/reference/cli/docker/image/tag/
+IMAGE_TAG_PATTERN = re.compile(r"^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$")
+
+# Services known to LocalStack, used to warn about typos in the services option
+KNOWN_SERVICES = {
+    "acm", "amplify", "apigateway", "apigatewayv2", "appconfig", "appflow", "application-autoscaling",
+    "appsync", "athena", "autoscaling", "backup", "batch", "ce", "cloudcontrol", "cloudformation",
+    "cloudfront", "cloudtrail", "cloudwatch", "codebuild", "codecommit", "codeconnections",
+    "codedeploy", "codepipeline", "cognito-identity", "cognito-idp", "config", "dms", "docdb",
+    "dynamodb", "dynamodbstreams", "ec2", "ecr", "ecs", "efs", "eks", "elasticache", "elasticbeanstalk",
+    "elb", "elbv2", "emr", "emr-serverless", "es", "events", "firehose", "fis", "glacier", "glue",
+    "iam", "identitystore", "iot", "iot-data", "iotanalytics", "iotwireless", "kafka", "kinesis",
+    "kinesisanalytics", "kinesisanalyticsv2", "kms", "lakeformation", "lambda", "logs", "managedblockchain",
+    "mediaconvert", "mediastore", "memorydb", "mq", "mwaa", "neptune", "opensearch", "organizations",
+    "pinpoint", "pipes", "qldb", "ram", "rds", "rds-data", "redshift", "redshift-data", "resource-groups",
+    "resourcegroupstaggingapi", "route53", "route53resolver", "s3", "s3control", "sagemaker", "scheduler",
+    "secretsmanager", "serverlessrepo", "servicediscovery", "ses", "sesv2", "shield", "sns", "sqs", "ssm",
+    "sso-admin", "stepfunctions", "sts", "support", "swf", "textract", "timestream-query",
+    "timestream-write", "transcribe", "transfer", "wafv2", "xray",
+}
+
+# Extension references: a pip requirement or a git URL
+EXTENSION_PATTERN = re.compile(
+    r"^(git\+https://[^\s]+|https://github\.com/[^\s]+|[A-Za-z0-9][A-Za-z0-9._-]*(\[[A-Za-z0-9,._-]+\])?([<>=!~]=?[A-Za-z0-9.*+!-]+)?)$"
+)
+
+# Extension forwarding requests to real AWS
+AWS_PROXY_EXTENSION = "localstack-extension-aws-proxy"
+
+# Default LocalStack image, without a tag
+DEFAULT_IMAGE = "localstack/localstack"
+
+# Services that take considerably longer to warm up (Big Data stack)
+HEAVY_SERVICES = {"athena", "emr", "emr-serverless", "glue", "kinesisanalytics", "kinesisanalyticsv2", "mwaa", "redshift"}
+
+# awslocal commands describing a resource, by service and resource type
+RESOURCE_DESCRIBE_COMMANDS = {
+    ("s3", "bucket"): ["s3api", "head-bucket", "--bucket"],
+    ("sqs", "queue"): ["sqs", "get-queue-url", "--queue-name"],
+    ("sns", "topic"): ["sns", "get-topic-attributes", "--topic-arn"],
+    ("dynamodb", "table"): ["dynamodb", "describe-table", "--table-name"],
+    ("lambda", "function"): ["lambda", "get-function", "--function-name"],
+    ("kinesis", "stream"): ["kinesis", "describe-stream-summary", "--stream-name"],
+    ("ssm", "parameter"): ["ssm", "get-parameter", "--name"],
+    ("secretsmanager", "secret"): ["secretsmanager", "describe-secret", "--secret-id"],
+    ("cloudformation", "stack"): ["cloudformation", "describe-stacks", "--stack-name"],
+}
+
+# S3 client methods presigned URLs can be created for, by HTTP method
+PRESIGN_METHODS = {"GET": "get_object", "PUT": "put_object", "DELETE": "delete_object", "HEAD": "head_object"}
+
+# Configuration keys whose values are redacted in config_dump
+SECRET_CONFIG_PATTERN = re.compile(r"TOKEN|SECRET|PASSWORD|PASSWD|CREDENTIAL|API_KEY|ACCESS_KEY|PRIVATE|AUTH", re.IGNORECASE)
+
+# Version constraint, e.g. ">=3.5.0"
+VERSION_CONSTRAINT_PATTERN = re.compile(r"^(>=|<=|==|!=|>|<|=)?\s*v?(\d+(?:\.\d+){0,2})$")
+
+# Valid Docker container names, used for the instance name
+INSTANCE_NAME_PATTERN = re.compile(r"^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,62}$")
+
+# Valid S3 bucket names
+BUCKET_NAME_PATTERN = re.compile(r"^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$")
+
+# Request log line written by LocalStack for every AWS API call, e.g.
+# "2024-01-01T12:00:00.000  INFO --- [...] localstack.request.aws : AWS s3.CreateBucket => 200"
+API_EVENT_PATTERN = re.compile(r"^(\S+).*\bAWS ([\w-]+)\.(\w+) => (\d+)")
+
+# Error returned for requests to services that are not enabled, e.g.
+# "Service 'sqs' is not enabled. Please check your 'SERVICES' configuration variable."
+SERVICE_NOT_ENABLED_PATTERN = re.compile(r"Service '([\w-]+)' is not enabled")
+
+# Default AWS region
+DEFAULT_REGION = "us-east-1"
+
+# Default endpoint of a LocalStack instance started with `start ... up`
+DEFAULT_ENDPOINT = "http://host.docker.internal:4566"
+
+# LocalStack platform API used for Cloud Pods and ephemeral instances
+PLATFORM_API_ENDPOINT = "https://api.localstack.cloud/v1"
+
+# Upper bound on the pages list_pods fetches from the Cloud Pods API
+LIST_PODS_MAX_PAGES = 100
+
+# Seconds to wait for LocalStack to become ready when start blocks on it
+DEFAULT_STARTUP_TIMEOUT = 120
+
+# Container backends Lambda and ECS containers can be run with
+CONTAINER_BACKENDS = {"docker", "podman"}
+
+# Where hot-reloaded Lambda code is mounted, Lambda containers mount the same
+# path from the Docker host
+LAMBDA_HOT_RELOAD_PATH = "/opt/lambda-hot-reload"
+
+# Cache volume mapping the services returned by start to their instance
+INSTANCES_VOLUME = "localstack-instances"
+
+# File in the logs volume of an instance where container records its name,
+# image, exposed ports, region, and test credentials
+INSTANCE_METADATA_FILE = "instance.json"
+
+# Where persisted state is kept between runs
+PERSISTENCE_BACKENDS = {"local", "s3"}
+
+# Lambda runtime images pulled ahead of time with prewarm_lambdas
+LAMBDA_RUNTIME_IMAGES = [
+    "public.ecr.aws/lambda/python:3.12",
+    "public.ecr.aws/lambda/nodejs:20",
+    "public.ecr.aws/lambda/java:21",
+    "public.ecr.aws/lambda/provided:al2023",
+]
+
+# Seconds to wait for LocalStack to become ready when heavy services are enabled
+HEAVY_STARTUP_TIMEOUT = 600
+
+# Pulls finishing faster than this many seconds are assumed to come from the
+# engine's cache, Dagger doesn't report whether an image was pulled
+IMAGE_CACHED_THRESHOLD = 2
+
+# Upper bound in seconds for the backoff between readiness probes
+READINESS_MAX_BACKOFF = 8
+
+
+class LocalstackError(Exception):
+    """Base class of the errors raised by the module.
+
+    Errors cross the Dagger API as plain messages, so the message starts with
+    the error code for callers to match on.
+    """
+
+    code = "LocalstackError"
+
+    def __init__(self, message: str):
+        super().__init__(f"{self.code}: {message}")
+
+
+class StartupTimeoutError(LocalstackError):
+    """LocalStack, its services, or its init scripts did not become ready in time."""
+
+    code = "StartupTimeout"
+
+
+class ProTokenRequiredError(LocalstackError, ValueError):
+    """A Pro feature was requested without an auth token."""
+
+    code = "ProTokenRequired"
+
+
+class ServiceNotEnabledError(LocalstackError):
+    """A request was made to a service that is not enabled."""
+
+    code = "ServiceNotEnabled"
+
+
+class PersistenceRequiredError(LocalstackError, ValueError):
+    """The service was not started with persisted state."""
+
+    code = "PersistenceRequired"
+
+
+class PodNotFoundError(LocalstackError):
+    """The requested Cloud Pod does not exist."""
+
+    code = "PodNotFound"
+
+
+class PodCorruptedError(LocalstackError):
+    """The archive of a Cloud Pod is damaged or incomplete."""
+
+    code = "PodCorrupted"
+
+
+@object_type
+class ServiceStatus:
+    """Status of a single LocalStack service."""
+
+    name: str = field()
+    status: str = field()
+
+
+@object_type
+class Sidecar:
+    """Container started next to LocalStack, reachable from it under its name."""
+
+    name: str = field()
+    image: str = field()
+    ports: list[int] = field()
+    env: list[str] = field()
+
+
+@object_type
+class ServiceEndpoint:
+    """URL under which a LocalStack service is reachable."""
+
+    name: str = field()
+    url: str = field()
+
+
+@object_type
+class PodInfo:
+    """Metadata of a Cloud Pod saved for the account."""
+
+    name: str = field()
+    size: int = field()
+    last_modified: str = field()
+
+
+@object_type
+class PodInventory:
+    """State files of a verified Cloud Pod, with the services they belong to."""
+
+    name: str = field()
+    size: int = field()
+    services: list[str] = field()
+    files: list[str] = field()
+
+
+@object_type
+class ExecResult:
+    """Output and exit code of a command run against LocalStack."""
+
+    output: str = field()
+    exit_code: int = field()
+
+
+@object_type
+class StopResult:
+    """Outcome of stopping a LocalStack service."""
+
+    graceful: bool = field()
+    output: str = field()
+
+
+@object_type
+class LambdaResult:
+    """Response of a Lambda invocation."""
+
+    payload: str = field()
+    status_code: int = field()
+    function_error: str = field()
+
+
+@object_type
+class TriggeredTarget:
+    """Target of an EventBridge rule that was sent an event by trigger_schedule."""
+
+    id: str = field()
+    arn: str = field()
+    error: str = field()
+
+
+@object_type
+class ConfigEntry:
+    """Configuration variable of a LocalStack instance."""
+
+    key: str = field()
+    value: str = field()
+
+
+@object_type
+class ClientEnvVariable:
+    """Environment variable configuring AWS clients."""
+
+    name: str = field()
+    value: str = field()
+
+
+@object_type
+class Credentials:
+    """AWS client settings to talk to a LocalStack instance."""
+
+    access_key_id: str = field()
+    secret_access_key: str = field()
+    region: str = field()
+    endpoint: str = field()
+
+
+@object_type
+class InstanceInfo:
+    """Metadata of a running LocalStack instance."""
+
+    version: str = field()
+    edition: str = field()
+    services: list[str] = field()
+    image: str = field()
+    ports: list[int] = field()
+    uptime: int = field()
+    name: str = field()
+
+
+@object_type
+class EphemeralInstance:
+    """Ephemeral LocalStack instance running in LocalStack Cloud."""
+
+    name: str = field()
+    id: str = field()
+    endpoint: str = field()
+    expiry_time: str = field()
+    idle_timeout: int = field()
+
+
+@object_type
+class StackOutput:
+    """Output of a CloudFormation stack."""
+
+    key: str = field()
+    value: str = field()
+
+
+@object_type
+class ApiCallCount:
+    """Number of calls made to an AWS API operation."""
+
+    service: str = field()
+    operation: str = field()
+    count: int = field()
+
+
+@object_type
+class ApiEvent:
+    """AWS API call handled by LocalStack, as reported in its logs."""
+
+    timestamp: str = field()
+    service: str = field()
+    operation: str = field()
+    status: int = field()
+
+
+@object_type
+class HealthStatus:
+    """Parsed response of the /_localstack/health endpoint."""
+
+    edition: str = field()
+    version: str = field()
+    services: list[ServiceStatus] = field()
+
+
+@object_type
+class BenchmarkResult:
+    """Time in seconds spent in each phase of starting LocalStack."""
+
+    version: str = field()
+    image_cached: bool = field()
+    image_pull: float = field()
+    container_start: float = field()
+    readiness: float = field()
+    total: float = field()
 
 
 @object_type
 class Localstack:
     """LocalStack service management functions."""
 
+    attached_endpoint: str = field(default="")
+    # Image used for the helper containers that talk to a running instance,
+    # e.g. awslocal, pulled through registry if given
+    image_name: str = field(default="")
+    registry: str = field(default="")
+
+    @function
+    async def attach(
+        self,
+        endpoint: Annotated[str, Doc("Endpoint of the running LocalStack instance (e.g. http://localstack.internal:4566)")]
+    ) -> "Localstack":
+        """Bind the module to an already running LocalStack instance instead of starting one."""
+        localstack_url = endpoint.rstrip("/")
+        if "://" not in localstack_url:
+            localstack_url = f"http://{localstack_url}"
+
+        # Fail right away if there is nothing to attach to
+        await self._get_health(localstack_url)
+        return Localstack(attached_endpoint=localstack_url, image_name=self.image_name, registry=self.registry)
+
+    def _endpoint(self, endpoint: Optional[str]) -> str:
+        """Resolve the endpoint to use, preferring the given one over the attached one."""
+        return endpoint or self.attached_endpoint or DEFAULT_ENDPOINT
+
+    @function
+    async def start(
+        self,
+        auth_token: Annotated[Optional[dagger.Secret], Doc("LocalStack Auth Token for authentication (required for the pro edition)")] = None,
+        configuration: Annotated[Optional[str], Doc("Configuration variables in format 'KEY1=value1,KEY2=value2'")] = None,
+        docker_sock: Annotated[Optional[dagger.Socket], Doc("Docker socket for container interactions")] = None,
+        image_name: Annotated[Optional[str], Doc("Custom LocalStack image name to use")] = None,
+        persist: Annotated[Optional[dagger.Directory], Doc("Directory used to seed persisted state (mounted at /var/lib/localstack, enables PERSISTENCE=1)")] = None,
+        image_tag: Annotated[Optional[str], Doc("Tag of the LocalStack image to use (e.g. '3.8.1')")] = None,
+        init_scripts: Annotated[Optional[dagger.Directory], Doc("Directory of init scripts to run once LocalStack is ready (mounted at /etc/localstack/init/ready.d)")] = None,
+        wait_for_init: Annotated[bool, Doc("Wait for the init scripts to complete before returning")] = False,
+        env: Annotated[Optional[list[str]], Doc("Environment variables in format 'KEY=value', set as-is without further parsing")] = None,
+        services: Annotated[Optional[list[str]], Doc("Services to enable (sets SERVICES)")] = None,
+        startup_timeout: Annotated[Optional[int], Doc("Wait up to this many seconds for LocalStack to be ready before returning")] = None,
+        debug: Annotated[bool, Doc("Enable verbose logging (DEBUG=1, LS_LOG=trace)")] = False,
+        hostname: Annotated[Optional[str], Doc("Stable hostname under which other containers in the session can reach LocalStack")] = None,
+        extensions: Annotated[Optional[list[str]], Doc("Extensions to install on startup (sets EXTENSION_AUTO_INSTALL)")] = None,
+        gateway_port: Annotated[int, Doc("Port the LocalStack gateway listens on (sets GATEWAY_LISTEN)")] = 4566,
+        extra_ports: Annotated[Optional[list[int]], Doc("Additional container ports to expose (e.g. for ECS tasks or RDS databases)")] = None,
+        proxy: Annotated[Optional[list[str]], Doc("Services to forward to real AWS through the AWS proxy extension (Pro only)")] = None,
+        heavy_services: Annotated[bool, Doc("Wait longer for startup when services with a long warmup (e.g. EMR, Athena) are enabled")] = False,
+        tls_cert: Annotated[Optional[dagger.File], Doc("PEM certificate the gateway serves HTTPS with, requires tls_key")] = None,
+        tls_key: Annotated[Optional[dagger.File], Doc("PEM private key of tls_cert")] = None,
+        edition: Annotated[Optional[str], Doc("LocalStack edition to run: community or pro (defaults to pro when an auth token is given)")] = None,
+        prewarm_lambdas: Annotated[bool, Doc("Keep Lambda containers warm and pull common runtime images (with docker_sock)")] = False,
+        lambda_network: Annotated[Optional[str], Doc("Docker network Lambda containers are attached to (LAMBDA_DOCKER_NETWORK)")] = None,
+        seed_s3: Annotated[Optional[dagger.Directory], Doc("Directory with one subdirectory per bucket, uploaded to S3 on startup")] = None,
+        seed_dynamo: Annotated[Optional[dagger.Directory], Doc("Directory of JSON files, each describing a DynamoDB table and its items, created on startup")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance (defaults to localstack- and a random suffix)")] = None,
+        registry: Annotated[Optional[str], Doc("Registry host (and path) to pull the image from, e.g. a mirror")] = None,
+        registry_auth: Annotated[Optional[dagger.Secret], Doc("Docker config JSON with the credentials to pull the image")] = None,
+        external_service_ports: Annotated[Optional[str], Doc("Port range for services that run a real server, as start-end (e.g. 4510-4559)")] = None,
+        region: Annotated[str, Doc("Default AWS region (DEFAULT_REGION)")] = DEFAULT_REGION,
+        s3_express: Annotated[bool, Doc("Check that S3 directory buckets (S3 Express One Zone) are available: requires the pro edition and enables s3")] = False,
+        env_file: Annotated[Optional[dagger.File], Doc(".env file with environment variables, overridden by env")] = None,
+        container_backend: Annotated[Optional[str], Doc("Container backend behind docker_sock: docker or podman")] = None,
+        disable_telemetry: Annotated[bool, Doc("Turn off LocalStack's usage analytics (DISABLE_EVENTS)")] = True,
+        sidecars: Annotated[Optional[list[Sidecar]], Doc("Containers to start next to LocalStack, created with sidecar")] = None,
+        timezone: Annotated[str, Doc("Timezone of the container (TZ), e.g. Europe/Berlin")] = "UTC",
+        lambda_cache: Annotated[Optional[dagger.CacheVolume], Doc("Cache volume for downloaded artifacts like Lambda layers, mounted at /var/lib/localstack/cache")] = None,
+        persistence_backend: Annotated[str, Doc("Where persisted state is kept: local (seeded from persist) or s3")] = "local",
+        persistence_s3_uri: Annotated[Optional[str], Doc("S3 location of the persisted state, e.g. s3://bucket/prefix (s3 backend)")] = None,
+        persistence_access_key_id: Annotated[Optional[dagger.Secret], Doc("AWS access key ID for persistence_s3_uri (s3 backend)")] = None,
+        persistence_secret_access_key: Annotated[Optional[dagger.Secret], Doc("AWS secret access key for persistence_s3_uri (s3 backend)")] = None,
+        lambda_hot_reload: Annotated[Optional[dagger.Directory], Doc("Lambda code to hot reload, mounted at /opt/lambda-hot-reload (with docker_sock)")] = None,
+        dns_address: Annotated[Optional[str], Doc("Address LocalStack's DNS server listens on (DNS_ADDRESS)")] = None,
+        disable_dns: Annotated[bool, Doc("Turn off LocalStack's DNS server")] = False,
+        strict_services: Annotated[Optional[bool], Doc("Fail requests to services not given in services (STRICT_SERVICE_LOADING), or start them on demand if false (defaults to LocalStack's behavior)")] = None,
+        keep_on_error: Annotated[bool, Doc("Keep the container running when a startup check fails, for debugging")] = False
+    ) -> dagger.Service:
+        """Start a LocalStack service with appropriate configuration."""
+        # Every top-level directory of seed_s3 becomes a bucket, top-level
+        # files (e.g. a README) don't belong to a bucket and are skipped
+        seed_buckets = []
+        if seed_s3:
+            for entry in await seed_s3.entries():
+                try:
+                    await seed_s3.directory(entry).entries()
+                except Exception:
+                    continue
+                seed_buckets.append(entry.rstrip("/"))
+            invalid = [bucket for bucket in seed_buckets if not BUCKET_NAME_PATTERN.match(bucket)]
+            if invalid:
+                raise ValueError(f"Invalid bucket names in seed_s3: {', '.join(invalid)}")
+
+        # Parse the DynamoDB fixtures up front so malformed ones fail fast
+        seed_tables = []
+        if seed_dynamo:
+            for entry in await seed_dynamo.entries():
+                if entry.endswith(".json"):
+                    seed_tables.append(self._dynamo_commands(entry, await seed_dynamo.file(entry).contents()))
+
+        # Name the instance up front, its volumes are named after it
+        instance_name = instance_name or f"localstack-{uuid.uuid4().hex[:8]}"
+
+        # Configure the container, start adds the readiness checks and seeding
+        container = await self.container(
+            auth_token=auth_token,
+            configuration=configuration,
+            docker_sock=docker_sock,
+            image_name=image_name,
+            persist=persist,
+            image_tag=image_tag,
+            init_scripts=init_scripts,
+            env=env,
+            services=services,
+            debug=debug,
+            hostname=hostname,
+            extensions=extensions,
+            gateway_port=gateway_port,
+            extra_ports=extra_ports,
+            proxy=proxy,
+            tls_cert=tls_cert,
+            tls_key=tls_key,
+            edition=edition,
+            prewarm_lambdas=prewarm_lambdas,
+            lambda_network=lambda_network,
+            instance_name=instance_name,
+            registry=registry,
+            registry_auth=registry_auth,
+            external_service_ports=external_service_ports,
+            region=region,
+            s3_express=s3_express,
+            env_file=env_file,
+            container_backend=container_backend,
+            disable_telemetry=disable_telemetry,
+            sidecars=sidecars,
+            timezone=timezone,
+            lambda_cache=lambda_cache,
+            persistence_backend=persistence_backend,
+            persistence_s3_uri=persistence_s3_uri,
+            persistence_access_key_id=persistence_access_key_id,
+            persistence_secret_access_key=persistence_secret_access_key,
+            lambda_hot_reload=lambda_hot_reload,
+            dns_address=dns_address,
+            disable_dns=disable_dns,
+            strict_services=strict_services,
+        )
+
+        enabled = self._enabled_services(services, s3_express)
+        extensions = [*(extensions or []), *([AWS_PROXY_EXTENSION] if proxy else [])]
+
+        # The service is reachable under the given hostname, or else under the
+        # instance name. Either way, record which instance it belongs to, so
+        # functions acting on the service find the instance's volumes.
+        service = container.as_service().with_hostname(hostname or instance_name)
+        await self._register_instance(service, instance_name)
+
+        # Services like EMR or Athena need a long warmup, so wait for them with
+        # an extended timeout
+        heavy = sorted(HEAVY_SERVICES.intersection(enabled)) if heavy_services else []
+
+        # Optionally block until LocalStack and the ready.d init scripts are ready
+        wait_for_scripts = init_scripts is not None and wait_for_init
+        if startup_timeout or wait_for_scripts or heavy or seed_buckets or seed_tables:
+            timeout = startup_timeout or DEFAULT_STARTUP_TIMEOUT
+            if heavy:
+                timeout = max(timeout, HEAVY_STARTUP_TIMEOUT)
+            await service.start()
+
+            # Don't leave a half-started container behind when a readiness
+            # check or a seed step fails, unless asked to for debugging
+            try:
+                endpoint = await service.endpoint(scheme="http")
+                await self._wait_until_ready(endpoint, timeout)
+                if heavy:
+                    await self.wait_for_services(services=heavy, timeout=timeout, endpoint=endpoint)
+                if wait_for_scripts:
+                    await self._wait_for_init(endpoint, timeout, instance_name)
+                if extensions:
+                    await self._check_extensions(extensions, instance_name)
+
+                # Seed from the same image LocalStack was pulled from, so no
+                # other registry has to be reachable
+                if seed_buckets or seed_tables:
+                    client = dag.container()
+                    if registry_auth:
+                        client = await self._with_registry_auth(client, registry_auth)
+                    client = self._client_container(endpoint, region, self._image(image_name, image_tag, registry), client)
+
+                # Upload the S3 fixtures, keeping relative paths as object keys
+                if seed_buckets:
+                    commands = []
+                    for bucket in seed_buckets:
+                        commands.append(["awslocal", "s3", "mb", f"s3://{bucket}"])
+                        commands.append(["awslocal", "s3", "sync", f"/seed/s3/{bucket}", f"s3://{bucket}"])
+                    await self._run_commands(
+                        client.with_mounted_directory("/seed/s3", seed_s3),
+                        commands,
+                    )
+
+                if seed_tables:
+                    await self._run_commands(
+                        client,
+                        [command for commands in seed_tables for command in commands],
+                    )
+            except Exception as e:
+                if keep_on_error:
+                    note = "the container was kept running for debugging"
+                else:
+                    try:
+                        await service.stop(kill=True)
+                        note = "the container was stopped"
+                    except Exception as stop_error:
+                        note = f"the container could not be stopped: {str(stop_error)}"
+                e.args = (f"{e.args[0] if e.args else type(e).__name__} ({note})", *e.args[1:])
+                raise
+
+        # Return as service
+        return service
+
+    @function
+    async def container(
+        self,
+        auth_token: Annotated[Optional[dagger.Secret], Doc("LocalStack Auth Token for authentication (required for the pro edition)")] = None,
+        configuration: Annotated[Optional[str], Doc("Configuration variables in format 'KEY1=value1,KEY2=value2'")] = None,
+        docker_sock: Annotated[Optional[dagger.Socket], Doc("Docker socket for container interactions")] = None,
+        image_name: Annotated[Optional[str], Doc("Custom LocalStack image name to use")] = None,
+        persist: Annotated[Optional[dagger.Directory], Doc("Directory used to seed persisted state (mounted at /var/lib/localstack, enables PERSISTENCE=1)")] = None,
+        image_tag: Annotated[Optional[str], Doc("Tag of the LocalStack image to use (e.g. '3.8.1')")] = None,
+        init_scripts: Annotated[Optional[dagger.Directory], Doc("Directory of init scripts to run once LocalStack is ready (mounted at /etc/localstack/init/ready.d)")] = None,
+        env: Annotated[Optional[list[str]], Doc("Environment variables in format 'KEY=value', set as-is without further parsing")] = None,
+        services: Annotated[Optional[list[str]], Doc("Services to enable (sets SERVICES)")] = None,
+        debug: Annotated[bool, Doc("Enable verbose logging (DEBUG=1, LS_LOG=trace)")] = False,
+        hostname: Annotated[Optional[str], Doc("Stable hostname under which other containers in the session can reach LocalStack")] = None,
+        extensions: Annotated[Optional[list[str]], Doc("Extensions to install on startup (sets EXTENSION_AUTO_INSTALL)")] = None,
+        gateway_port: Annotated[int, Doc("Port the LocalStack gateway listens on (sets GATEWAY_LISTEN)")] = 4566,
+        extra_ports: Annotated[Optional[list[int]], Doc("Additional container ports to expose (e.g. for ECS tasks or RDS databases)")] = None,
+        proxy: Annotated[Optional[list[str]], Doc("Services to forward to real AWS through the AWS proxy extension (Pro only)")] = None,
+        tls_cert: Annotated[Optional[dagger.File], Doc("PEM certificate the gateway serves HTTPS with, requires tls_key")] = None,
+        tls_key: Annotated[Optional[dagger.File], Doc("PEM private key of tls_cert")] = None,
+        edition: Annotated[Optional[str], Doc("LocalStack edition to run: community or pro (defaults to pro when an auth token is given)")] = None,
+        prewarm_lambdas: Annotated[bool, Doc("Keep Lambda containers warm and pull common runtime images (with docker_sock)")] = False,
+        lambda_network: Annotated[Optional[str], Doc("Docker network Lambda containers are attached to (LAMBDA_DOCKER_NETWORK)")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance (defaults to localstack- and a random suffix)")] = None,
+        registry: Annotated[Optional[str], Doc("Registry host (and path) to pull the image from, e.g. a mirror")] = None,
+        registry_auth: Annotated[Optional[dagger.Secret], Doc("Docker config JSON with the credentials to pull the image")] = None,
+        external_service_ports: Annotated[Optional[str], Doc("Port range for services that run a real server, as start-end (e.g. 4510-4559)")] = None,
+        region: Annotated[str, Doc("Default AWS region (DEFAULT_REGION)")] = DEFAULT_REGION,
+        s3_express: Annotated[bool, Doc("Check that S3 directory buckets (S3 Express One Zone) are available: requires the pro edition and enables s3")] = False,
+        env_file: Annotated[Optional[dagger.File], Doc(".env file with environment variables, overridden by env")] = None,
+        container_backend: Annotated[Optional[str], Doc("Container backend behind docker_sock: docker or podman")] = None,
+        disable_telemetry: Annotated[bool, Doc("Turn off LocalStack's usage analytics (DISABLE_EVENTS)")] = True,
+        sidecars: Annotated[Optional[list[Sidecar]], Doc("Containers to start next to LocalStack, created with sidecar")] = None,
+        timezone: Annotated[str, Doc("Timezone of the container (TZ), e.g. Europe/Berlin")] = "UTC",
+        lambda_cache: Annotated[Optional[dagger.CacheVolume], Doc("Cache volume for downloaded artifacts like Lambda layers, mounted at /var/lib/localstack/cache")] = None,
+        persistence_backend: Annotated[str, Doc("Where persisted state is kept: local (seeded from persist) or s3")] = "local",
+        persistence_s3_uri: Annotated[Optional[str], Doc("S3 location of the persisted state, e.g. s3://bucket/prefix (s3 backend)")] = None,
+        persistence_access_key_id: Annotated[Optional[dagger.Secret], Doc("AWS access key ID for persistence_s3_uri (s3 backend)")] = None,
+        persistence_secret_access_key: Annotated[Optional[dagger.Secret], Doc("AWS secret access key for persistence_s3_uri (s3 backend)")] = None,
+        lambda_hot_reload: Annotated[Optional[dagger.Directory], Doc("Lambda code to hot reload, mounted at /opt/lambda-hot-reload (with docker_sock)")] = None,
+        dns_address: Annotated[Optional[str], Doc("Address LocalStack's DNS server listens on (DNS_ADDRESS)")] = None,
+        disable_dns: Annotated[bool, Doc("Turn off LocalStack's DNS server")] = False,
+        strict_services: Annotated[Optional[bool], Doc("Fail requests to services not given in services (STRICT_SERVICE_LOADING), or start them on demand if false (defaults to LocalStack's behavior)")] = None
+    ) -> dagger.Container:
+        """Configure the LocalStack container without starting it, to customize it further.
+
+        Changes made to the container are not managed by the module: start the
+        service yourself with as_service once done.
+        """
+        # Validate the image tag; full image references belong in image_name
+        if image_tag:
+            if image_name:
+                raise ValueError("image_tag cannot be combined with image_name, include the tag in image_name instead")
+            if not IMAGE_TAG_PATTERN.match(image_tag):
+                raise ValueError(f"Invalid image tag '{image_tag}'. Use image_name to pass a full image reference.")
+
+        # Resolve the edition, an auth token selects pro unless told otherwise
+        if edition is None:
+            edition = "pro" if auth_token else "community"
+        if edition not in ("community", "pro"):
+            raise ValueError(f"Invalid edition '{edition}'. Supported editions are: community, pro")
+        if edition == "pro" and not auth_token:
+            raise ProTokenRequiredError("The pro edition requires an auth_token")
+        if edition == "community" and auth_token:
+            print("Warning: Ignoring the auth_token, it is not used by the community edition")
+        if s3_express and edition != "pro":
+            raise ProTokenRequiredError("s3_express requires the pro edition")
+
+        external_ports = self._port_range(external_service_ports) if external_service_ports else []
+
+        if container_backend:
+            if container_backend not in CONTAINER_BACKENDS:
+                raise ValueError(f"Invalid container backend '{container_backend}'. Supported backends are: {', '.join(sorted(CONTAINER_BACKENDS))}")
+            if not docker_sock:
+                raise ValueError("container_backend requires docker_sock")
+
+        if instance_name and not INSTANCE_NAME_PATTERN.match(instance_name):
+            raise ValueError(f"Invalid instance name '{instance_name}'")
+
+        # The s3 backend needs a location and credentials, the local one none of them
+        s3_options = {
+            "persistence_s3_uri": persistence_s3_uri,
+            "persistence_access_key_id": persistence_access_key_id,
+            "persistence_secret_access_key": persistence_secret_access_key,
+        }
+        if persistence_backend not in PERSISTENCE_BACKENDS:
+            raise ValueError(f"Invalid persistence backend '{persistence_backend}'. Supported backends are: {', '.join(sorted(PERSISTENCE_BACKENDS))}")
+        if persistence_backend == "s3":
+            missing = [option for option, value in s3_options.items() if not value]
+            if missing:
+                raise ValueError(f"The s3 persistence backend requires {', '.join(missing)}")
+            if not persistence_s3_uri.startswith("s3://"):
+                raise ValueError(f"Invalid persistence_s3_uri '{persistence_s3_uri}', expected s3://bucket/prefix")
+            if persist:
+                raise ValueError("persist seeds the local persistence backend and cannot be combined with the s3 backend")
+        else:
+            given = [option for option, value in s3_options.items() if value]
+            if given:
+                raise ValueError(f"{', '.join(given)} require persistence_backend=s3")
+
+        image = self._image(image_name, image_tag, registry)
+
+        # Start with base container config, authenticating the pull if needed.
+        # Registry credentials are only used for the pull, not set in the container.
+        container = dag.container()
+        if registry_auth:
+            container = await self._with_registry_auth(container, registry_auth)
+            try:
+                container = await container.from_(image).sync()
+            except Exception as e:
+                raise Exception(f"Failed to pull '{image}' with the given registry_auth: {str(e)}")
+        else:
+            container = container.from_(image)
+
+        # Give every instance its own name. LocalStack names the containers it
+        # creates (e.g. for Lambda) after it, so parallel pipelines sharing a
+        # Docker daemon don't collide.
+        instance_name = instance_name or f"localstack-{uuid.uuid4().hex[:8]}"
+        container = container.with_env_variable("MAIN_CONTAINER_NAME", instance_name)
+
+        # Mount Docker socket if provided
+        if docker_sock:
+            container = container.with_unix_socket("/var/run/docker.sock", docker_sock)
+
+        # Run Lambda containers on the given backend. Podman serves the Docker
+        # API, so both are used through the mounted socket.
+        if container_backend:
+            container = (
+                container
+                .with_env_variable("LAMBDA_RUNTIME_EXECUTOR", "docker")
+                .with_env_variable("DOCKER_HOST", "unix:///var/run/docker.sock")
+            )
+
+        # Keep LocalStack's log directory in a cache volume of the instance so
+        # logs can be read from outside the running service. It is cleared
+        # once the container is set up, see below.
+        container = container.with_mounted_cache("/var/lib/localstack/logs", self._logs_volume(instance_name))
+
+        # Attach Lambda containers to a Docker network. Dagger services don't run
+        # on a Docker network, so there is nothing to detect when none is given.
+        if lambda_network:
+            container = container.with_env_variable("LAMBDA_DOCKER_NETWORK", lambda_network)
+
+        # Keep Lambda containers around between invocations, and pull the runtime
+        # images up front so the first invocation doesn't have to
+        if prewarm_lambdas:
+            container = container.with_env_variable("LAMBDA_KEEPALIVE_MS", "3600000")
+            if docker_sock:
+                pulled = await (
+                    dag.container()
+                    .from_("docker:cli")
+                    .with_unix_socket("/var/run/docker.sock", docker_sock)
+                    .with_exec(["sh", "-c", " && ".join(f"docker pull -q {image}" for image in LAMBDA_RUNTIME_IMAGES)])
+                    .stdout()
+                )
+                print(f"Pulled Lambda runtime images:\n{pulled.strip()}")
+
+        # Mount persisted state if provided. The instance's state volume is
+        # seeded with the directory on first use and mounted without a source,
+        # so functions acting on the instance later see the same volume.
+        if persist:
+            await (
+                dag.container()
+                .from_("python:3.9-slim")
+                .with_mounted_cache("/state", self._state_volume(instance_name))
+                .with_mounted_directory("/seed", persist)
+                .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+                .with_exec(["sh", "-c", 'if [ -z "$(ls -A /state)" ]; then cp -a /seed/. /state/; fi'])
+                .sync()
+            )
+            container = (
+                container
+                .with_mounted_cache("/var/lib/localstack", self._state_volume(instance_name))
+                .with_env_variable("PERSISTENCE", "1")
+            )
+
+        # With the s3 backend, fill the state volume from the bucket before
+        # LocalStack starts. sync_persistence writes it back.
+        if persistence_backend == "s3":
+            await (
+                self._persistence_container(instance, persistence_access_key_id, persistence_secret_access_key)
+                .with_exec(["aws", "s3", "sync", persistence_s3_uri, "/state", "--delete", "--exclude", "logs/*"])
+                .sync()
+            )
+            container = (
+                container
+                .with_mounted_cache("/var/lib/localstack", self._state_volume(instance_name))
+                .with_env_variable("PERSISTENCE", "1")
+            )
+
+        # Keep downloaded artifacts such as Lambda layers across runs. The cache
+        # only holds downloads, so it is safe to share between pipelines.
+        if lambda_cache:
+            container = container.with_mounted_cache("/var/lib/localstack/cache", lambda_cache)
+
+        # Mount code for Lambda hot reloading. Functions created from the
+        # hot-reload bucket marker run the code at the given path instead of a
+        # zip, and pick up changes without being redeployed.
+        if lambda_hot_reload:
+            if not docker_sock:
+                raise ValueError("lambda_hot_reload requires docker_sock")
+            container = (
+                container
+                .with_mounted_directory(LAMBDA_HOT_RELOAD_PATH, lambda_hot_reload)
+                .with_env_variable("BUCKET_MARKER_LOCAL", "hot-reload")
+                .with_env_variable("LAMBDA_MOUNT_CWD", LAMBDA_HOT_RELOAD_PATH)
+            )
+            print(
+                "Lambda hot reloading is active: create functions with "
+                f"--code S3Bucket=hot-reload,S3Key={LAMBDA_HOT_RELOAD_PATH}. "
+                "Lambda containers mount this path from the Docker host, so the code must exist there too. "
+                "Only interpreted runtimes (Python, Node.js) reload, and dependencies must be built for the host architecture."
+            )
+
+        # Mount init scripts, LocalStack runs them with awslocal available
+        if init_scripts:
+            container = container.with_mounted_directory("/etc/localstack/init/ready.d", init_scripts)
+
+        # Serve HTTPS with the given certificate. LocalStack expects the
+        # certificate and key in a single PEM file.
+        if tls_cert or tls_key:
+            if not (tls_cert and tls_key):
+                raise ValueError("tls_cert and tls_key must be given together")
+            server_pem = (
+                dag.container().from_("python:3.9-slim")
+                .with_file("/tmp/tls/cert.pem", tls_cert)
+                .with_file("/tmp/tls/key.pem", tls_key)
+                .with_exec(["sh", "-c", "cat /tmp/tls/cert.pem /tmp/tls/key.pem > /tmp/tls/server.pem"])
+                .file("/tmp/tls/server.pem")
+            )
+            container = (
+                container
+                .with_file("/etc/localstack/tls/server.pem", server_pem)
+                .with_env_variable("CUSTOM_SSL_CERT_PATH", "/etc/localstack/tls/server.pem")
+            )
+
+        # Add Auth Token
+        if edition == "pro":
+            container = container.with_secret_variable("LOCALSTACK_AUTH_TOKEN", auth_token)
+
+        # Pin the timezone so schedules behave the same on every runner
+        container = container.with_env_variable("TZ", timezone)
+
+        # Don't send usage analytics from pipelines, this doesn't affect functionality
+        if disable_telemetry:
+            container = container.with_env_variable("DISABLE_EVENTS", "1")
+
+        # Enable verbose logging, trace logs include full request and response payloads
+        if debug:
+            container = (
+                container
+                .with_env_variable("DEBUG", "1")
+                .with_env_variable("LS_LOG", "trace")
+            )
+
+        # Install extensions on startup
+        extensions = list(extensions or [])
+
+        # Forward the given services to real AWS using the AWS proxy extension
+        if proxy:
+            if edition != "pro":
+                raise ProTokenRequiredError("proxy requires the pro edition")
+            extensions.append(AWS_PROXY_EXTENSION)
+            container = container.with_env_variable("AWS_PROXY_SERVICES", ",".join(proxy))
+
+        if extensions:
+            container = container.with_env_variable("EXTENSION_AUTO_INSTALL", ",".join(extensions))
+
+        # Set the default region, also used by awslocal in init scripts
+        if region != DEFAULT_REGION:
+            container = (
+                container
+                .with_env_variable("DEFAULT_REGION", region)
+                .with_env_variable("AWS_DEFAULT_REGION", region)
+            )
+
+        # Add configuration variables if provided
+        if configuration:
+            for config_pair in configuration.split(','):
+                if '=' in config_pair:
+                    key, value = config_pair.strip().split('=', 1)
+                    container = container.with_env_variable(key, value)
+
+        # Add the services to enable, directory buckets are served by the S3 provider
+        enabled = self._enabled_services(services, s3_express)
+        if enabled:
+            unknown = [service_name for service_name in enabled if service_name not in KNOWN_SERVICES]
+            if unknown:
+                print(f"Warning: Unrecognized services: {', '.join(unknown)}")
+
+            container = container.with_env_variable("SERVICES", ",".join(enabled))
+
+        # Only load the enabled services, so requests to any other service fail
+        # instead of silently starting it. LocalStack does this by default when
+        # services are given, so only set it when asked to either way.
+        if strict_services:
+            if not enabled:
+                raise ValueError("strict_services requires services")
+            container = container.with_env_variable("STRICT_SERVICE_LOADING", "1")
+        elif strict_services is False:
+            container = container.with_env_variable("STRICT_SERVICE_LOADING", "0")
+
+        # Add variables from the .env file, these take precedence over configuration
+        if env_file:
+            for key, value in self._parse_env_file(await env_file.contents()):
+                container = container.with_env_variable(key, value)
+
+        # Add environment variables, these take precedence over configuration and the .env file
+        for variable in env or []:
+            key, _, value = variable.partition('=')
+            container = container.with_env_variable(key.strip(), value)
+
+        # Move the gateway to a different port if requested
+        if gateway_port != 4566:
+            container = container.with_env_variable("GATEWAY_LISTEN", f"0.0.0.0:{gateway_port},0.0.0.0:443")
+
+        # Make LocalStack generate URLs (e.g. SQS queue URLs) with the stable hostname
+        if hostname:
+            container = container.with_env_variable("LOCALSTACK_HOST", f"{hostname}:{gateway_port}")
+
+        # Move or turn off the DNS server, which can get in the way of name
+        # resolution in other containers. DNS_ADDRESS=0 disables it.
+        if dns_address and disable_dns:
+            raise ValueError("dns_address cannot be combined with disable_dns")
+        if dns_address:
+            container = container.with_env_variable("DNS_ADDRESS", dns_address)
+        if disable_dns:
+            container = container.with_env_variable("DNS_ADDRESS", "0")
+
+        # Hand out ports from the given range to resources like RDS databases
+        if external_ports:
+            container = (
+                container
+                .with_env_variable("EXTERNAL_SERVICE_PORTS_START", str(external_ports[0]))
+                .with_env_variable("EXTERNAL_SERVICE_PORTS_END", str(external_ports[-1] + 1))
+            )
+
+        # Add common ports (gateway and 443), the gateway comes first so it is
+        # the port returned by the service endpoint
+        container = (
+            container
+            .with_exposed_port(gateway_port)
+            .with_exposed_port(443)
+        )
+        for port in [*(extra_ports or []), *external_ports]:
+            container = container.with_exposed_port(port)
+
+        # Start the sidecars with LocalStack, which reaches them by name
+        for sidecar in sidecars or []:
+            container = container.with_service_binding(sidecar.name, self._sidecar_service(sidecar))
+
+        # Clear the logs volume, so a reused instance name doesn't show the
+        # logs of an earlier run, and record what the LocalStack API doesn't
+        # report with its default configuration. The region is read back from
+        # the container, as env or configuration may have overridden it.
+        metadata = {
+            "name": instance_name,
+            "image": image,
+            "ports": [gateway_port, 443, *(extra_ports or []), *external_ports],
+            "region": await container.env_variable("DEFAULT_REGION") or DEFAULT_REGION,
+            "access_key_id": await container.env_variable("TEST_AWS_ACCESS_KEY_ID") or "test",
+            "secret_access_key": await container.env_variable("TEST_AWS_SECRET_ACCESS_KEY") or "test",
+        }
+        await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_cache("/logs", self._logs_volume(instance_name))
+            .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+            .with_env_variable("METADATA", json.dumps(metadata))
+            .with_exec(["sh", "-c", f"find /logs -mindepth 1 -delete && printf '%s' \"$METADATA\" > /logs/{INSTANCE_METADATA_FILE}"])
+            .sync()
+        )
+
+        return container
+
+    def _enabled_services(self, services: Optional[list[str]], s3_express: bool) -> list[str]:
+        """Split and deduplicate the services to enable, keeping the given order."""
+        enabled = []
+        if services:
+            for entry in [*services, *(["s3"] if s3_express else [])]:
+                for service_name in entry.split(','):
+                    service_name = service_name.strip().lower()
+                    if service_name and service_name not in enabled:
+                        enabled.append(service_name)
+        return enabled
+
+    @function
+    def sidecar(
+        self,
+        name: Annotated[str, Doc("Hostname LocalStack reaches the sidecar under")],
+        image: Annotated[str, Doc("Image of the sidecar")],
+        ports: Annotated[Optional[list[int]], Doc("Ports the sidecar listens on")] = None,
+        env: Annotated[Optional[list[str]], Doc("Environment variables in format 'KEY=value'")] = None
+    ) -> Sidecar:
+        """Describe a container to start next to LocalStack with start."""
+        return Sidecar(name=name, image=image, ports=ports or [], env=env or [])
+
+    @function
+    async def sidecar_endpoints(
+        self,
+        sidecars: Annotated[list[Sidecar], Doc("Sidecars passed to start")]
+    ) -> list[ServiceEndpoint]:
+        """Get the URL of every port of the sidecars started with start, listed as <name>-<port>."""
+        endpoints = []
+        for sidecar in sidecars:
+            service = self._sidecar_service(sidecar)
+            for port in sidecar.ports:
+                url = await service.endpoint(port=port, scheme="http")
+                endpoints.append(ServiceEndpoint(name=f"{sidecar.name}-{port}", url=url))
+
+        return endpoints
+
+    def _sidecar_service(self, sidecar: Sidecar) -> dagger.Service:
+        """Build the service of a sidecar. The same spec yields the same service, so it is only started once."""
+        container = dag.container().from_(sidecar.image)
+        for variable in sidecar.env:
+            key, _, value = variable.partition("=")
+            container = container.with_env_variable(key.strip(), value)
+        for port in sidecar.ports:
+            container = container.with_exposed_port(port)
+
+        return container.as_service()
+
+    @function
+    async def load_state_dir(
+        self,
+        state_dir: Annotated[dagger.Directory, Doc("LocalStack persistence directory, as found in /var/lib/localstack")],
+        auth_token: Annotated[Optional[dagger.Secret], Doc("LocalStack Auth Token for authentication (required for the pro edition)")] = None
+    ) -> dagger.Service:
+        """Start LocalStack from a local persistence directory."""
+        # A persistence directory keeps the service state in a state/ subdirectory
+        entries = await state_dir.entries()
+        if "state/" not in entries and "state" not in entries:
+            raise ValueError("The directory does not look like a LocalStack persistence directory: missing state/")
+
+        return await self.start(auth_token=auth_token, persist=state_dir)
+
+    async def _instance(self, service: Optional[dagger.Service] = None, instance_name: Optional[str] = None) -> str:
+        """Resolve the instance a function acts on from its name, or the service start returned for it."""
+        if instance_name:
+            return instance_name
+        if not service:
+            raise ValueError("Pass the service returned by start or its instance_name")
+
+        instance = await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_cache("/instances", dag.cache_volume(INSTANCES_VOLUME))
+            .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+            .with_exec(["sh", "-c", f"cat /instances/{await self._service_key(service)} 2>/dev/null; true"])
+            .stdout()
+        )
+        if not instance.strip():
+            raise ValueError("The service was not started with start, pass its instance_name instead")
+        return instance.strip()
+
+    async def _register_instance(self, service: dagger.Service, instance_name: str) -> None:
+        """Record the instance a service returned by start belongs to."""
+        await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_cache("/instances", dag.cache_volume(INSTANCES_VOLUME))
+            .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+            .with_env_variable("INSTANCE_NAME", instance_name)
+            .with_exec(["sh", "-c", f"printf '%s' \"$INSTANCE_NAME\" > /instances/{await self._service_key(service)}"])
+            .sync()
+        )
+
+    async def _service_key(self, service: dagger.Service) -> str:
+        """Key of a service that is stable across calls. Services share hostnames
+        across pipelines, but their IDs include the unique instance name."""
+        return hashlib.sha256((await service.id()).encode()).hexdigest()
+
+    def _state_volume(self, instance: str) -> dagger.CacheVolume:
+        """Cache volume holding the persisted state of an instance."""
+        return dag.cache_volume(f"localstack-state-{instance}")
+
+    def _logs_volume(self, instance: str) -> dagger.CacheVolume:
+        """Cache volume holding the log directory of an instance."""
+        return dag.cache_volume(f"localstack-logs-{instance}")
+
+    async def _instance_metadata(self, instance: str) -> dict:
+        """Image and exposed ports recorded by container for an instance."""
+        output = await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_cache("/logs", self._logs_volume(instance))
+            .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+            .with_exec(["sh", "-c", f"cat /logs/{INSTANCE_METADATA_FILE} 2>/dev/null; true"])
+            .stdout()
+        )
+        if not output.strip():
+            raise Exception(f"No instance named '{instance}' was started with start")
+        return json.loads(output)
+
+    def _parse_env_file(self, contents: str) -> list[tuple[str, str]]:
+        """Parse a .env file into key/value pairs, handling comments, quotes, and export prefixes."""
+        variables = []
+        for number, line in enumerate(contents.splitlines(), start=1):
+            line = line.strip()
+            if not line or line.startswith("#"):
+                continue
+            if line.startswith("export "):
+                line = line[len("export "):].lstrip()
+
+            key, separator, value = line.partition("=")
+            key = key.strip()
+            if not separator or not re.fullmatch(r"[A-Za-z_][A-Za-z0-9_]*", key):
+                raise ValueError(f"Invalid line {number} in env_file: {line}")
+
+            value = value.strip()
+            if value[:1] in ("'", '"'):
+                # Quoted values keep everything up to the closing quote, double
+                # quotes support escaped characters
+                quote = value[0]
+                end = value.find(quote, 1)
+                while quote == '"' and end > 0 and value[end - 1] == "\\":
+                    end = value.find(quote, end + 1)
+                if end < 0:
+                    raise ValueError(f"Unterminated quote on line {number} in env_file")
+                value = value[1:end]
+                if quote == '"':
+                    value = value.replace('\\"', '"').replace("\\n", "\n")
+            else:
+                # Unquoted values end at an inline comment
+                value = re.split(r"\s+#", value, maxsplit=1)[0].strip()
+
+            variables.append((key, value))
+
+        return variables
+
+    def _port_range(self, ports: str) -> list[int]:
+        """Parse a start-end port range into the list of its ports, both ends included."""
+        try:
+            start, end = (int(port) for port in ports.split("-", 1))
+        except ValueError:
+            raise ValueError(f"Invalid port range '{ports}', use start-end (e.g. 4510-4559)")
+        if not 0 < start <= end < 65536:
+            raise ValueError(f"Invalid port range '{ports}'")
+        return list(range(start, end + 1))
+
+    async def _with_registry_auth(self, container: dagger.Container, docker_config: dagger.Secret) -> dagger.Container:
+        """Add the registry credentials of a Docker config JSON to a container."""
+        try:
+            auths = json.loads(await docker_config.plaintext())["auths"]
+        except (ValueError, KeyError, TypeError):
+            raise ValueError("registry_auth is not a Docker config JSON with an 'auths' section")
+
+        for address, credentials in auths.items():
+            if credentials.get("auth"):
+                username, _, password = base64.b64decode(credentials["auth"]).decode().partition(":")
+            else:
+                username, password = credentials.get("username", ""), credentials.get("password", "")
+            secret = dag.set_secret(f"localstack-registry-auth-{address}", password)
+            container = container.with_registry_auth(address, username, secret)
+
+        return container
+
+    def _dynamo_commands(self, name: str, fixture: str) -> list[list[str]]:
+        """Build the awslocal commands creating a DynamoDB table and its items from a JSON fixture."""
+        try:
+            table = json.loads(fixture)
+            table_name = table["TableName"]
+            key_schema = table["KeySchema"]
+            attribute_definitions = table["AttributeDefinitions"]
+            items = table.get("Items", [])
+            if not isinstance(items, list):
+                raise ValueError("Items must be a list")
+        except (ValueError, KeyError, TypeError) as e:
+            raise ValueError(f"Malformed DynamoDB fixture '{name}': {str(e)}")
+
+        commands = [[
+            "awslocal", "dynamodb", "create-table",
+            "--table-name", table_name,
+            "--key-schema", json.dumps(key_schema),
+            "--attribute-definitions", json.dumps(attribute_definitions),
+            "--billing-mode", "PAY_PER_REQUEST",
+        ]]
+
+        # batch-write-item accepts at most 25 items per request
+        for start in range(0, len(items), 25):
+            request_items = {table_name: [{"PutRequest": {"Item": item}} for item in items[start:start + 25]]}
+            commands.append(["awslocal", "dynamodb", "batch-write-item", "--request-items", json.dumps(request_items)])
+
+        return commands
+
+    async def _check_extensions(self, extensions: list[str], instance: str) -> None:
+        """Fail if the startup logs of the instance report an extension that could not be installed."""
+        # The logs volume of the instance is cleared when its container is
+        # built, so only lines from this startup are checked
+        logs = await self.logs(instance_name=instance)
+        failed = [
+            extension for extension in extensions
+            if any(
+                extension in line and "error" in line.lower()
+                for line in logs.splitlines()
+            )
+        ]
+        if failed:
+            raise Exception(f"Failed to install extensions: {', '.join(failed)}. Check the LocalStack logs for details.")
+
+    async def _wait_until_ready(self, localstack_url: str, timeout: int) -> None:
+        """Poll /_localstack/health with exponential backoff until LocalStack responds successfully."""
+        started = time.monotonic()
+        deadline = started + timeout
+        last_response = "no response"
+        delay = 0.5
+        attempts = 0
+        while True:
+            attempts += 1
+            try:
+                response = requests.get(f"{localstack_url}/_localstack/health", timeout=5)
+                last_response = f"{response.status_code} {response.text}"
+                if response.ok:
+                    return
+            except requests.RequestException as e:
+                last_response = str(e)
+
+            remaining = deadline - time.monotonic()
+            if remaining <= 0:
+                elapsed = time.monotonic() - started
+                raise StartupTimeoutError(
+                    f"LocalStack was not ready after {attempts} attempts in {elapsed:.1f} seconds. "
+                    f"Last health response: {last_response}"
+                )
+
+            await asyncio.sleep(min(delay, remaining))
+            delay = min(delay * 2, READINESS_MAX_BACKOFF)
+
+    async def _wait_for_init(self, localstack_url: str, timeout: int, instance: Optional[str] = None) -> list[str]:
+        """Poll /_localstack/init/ready until the ready.d stage has completed and return the scripts that ran."""
+        deadline = time.monotonic() + timeout
+        while True:
+            try:
+                response = requests.get(f"{localstack_url}/_localstack/init/ready")
+                response.raise_for_status()
+                init = response.json()
+                scripts = init.get("scripts", [])
+
+                failed = [
+                    script.get("name", "")
+                    for script in scripts
+                    if script.get("state") == "ERROR"
+                ]
+                if failed:
+                    # Include what the scripts logged, as far as the logs are available
+                    try:
+                        logs = await self.logs(instance_name=instance) if instance else ""
+                    except Exception:
+                        logs = ""
+                    output = [line for line in logs.splitlines() if any(name and name in line for name in failed)]
+                    details = "\n".join(output) if output else "Check the LocalStack logs for their output."
+                    raise Exception(f"Init scripts failed: {', '.join(failed)}\n{details}")
+                if init.get("completed"):
+                    return [script.get("name", "") for script in scripts]
+            except requests.RequestException:
+                pass
+
+            if time.monotonic() >= deadline:
+                raise StartupTimeoutError(f"Timed out after {timeout} seconds waiting for init scripts to complete")
+
+            await asyncio.sleep(1)
+
+    @function
+    async def benchmark(
+        self,
+        auth_token: Annotated[Optional[dagger.Secret], Doc("LocalStack Auth Token for authentication (required for the pro edition)")] = None,
+        image_name: Annotated[Optional[str], Doc("Custom LocalStack image name to use")] = None,
+        image_tag: Annotated[Optional[str], Doc("Tag of the LocalStack image to use (e.g. '3.8.1')")] = None,
+        services: Annotated[Optional[list[str]], Doc("Services to enable (sets SERVICES)")] = None,
+        timeout: Annotated[int, Doc("Seconds to wait for LocalStack to be ready")] = DEFAULT_STARTUP_TIMEOUT
+    ) -> BenchmarkResult:
+        """Start a throwaway LocalStack instance and measure how long each phase of its startup takes."""
+        started = time.monotonic()
+        container = await self.container(auth_token=auth_token, image_name=image_name, image_tag=image_tag, services=services)
+
+        # Resolving the container pulls the image unless the engine has it cached
+        phase = time.monotonic()
+        await container.sync()
+        image_pull = time.monotonic() - phase
+
+        service = container.as_service()
+        try:
+            phase = time.monotonic()
+            await service.start()
+            endpoint = await service.endpoint(scheme="http")
+            container_start = time.monotonic() - phase
+
+            phase = time.monotonic()
+            await self._wait_until_ready(endpoint, timeout)
+            readiness = time.monotonic() - phase
+            total = time.monotonic() - started
+
+            try:
+                version = requests.get(f"{endpoint}/_localstack/info", timeout=5).json().get("version", "")
+            except (requests.RequestException, ValueError):
+                version = ""
+        finally:
+            await service.stop()
+
+        return BenchmarkResult(
+            version=version,
+            image_cached=image_pull < IMAGE_CACHED_THRESHOLD,
+            image_pull=round(image_pull, 2),
+            container_start=round(container_start, 2),
+            readiness=round(readiness, 2),
+            total=round(total, 2),
+        )
+
+    @function
+    async def wait_for_init(
+        self,
+        timeout: Annotated[int, Doc("Seconds to wait for the init scripts to complete")] = DEFAULT_STARTUP_TIMEOUT,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        service: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start, used instead of endpoint and to include the script logs in failures")] = None
+    ) -> str:
+        """Wait until the ready.d init scripts of a running LocalStack instance have completed, failing if one of them failed."""
+        if service:
+            scripts = await self._wait_for_init(await service.endpoint(scheme="http"), timeout, await self._instance(service))
+        else:
+            scripts = await self._wait_for_init(self._endpoint(endpoint), timeout)
+        if not scripts:
+            return "Init completed, no ready.d scripts were run."
+        return f"Init scripts completed: {', '.join(scripts)}"
+
+    @function
+    async def install_extension(
+        self,
+        name: Annotated[str, Doc("Extension to install, as pip package (e.g. localstack-extension-mailhog) or GitHub URL")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None
+    ) -> str:
+        """Install an extension into a running LocalStack instance and return the install log."""
+        if not EXTENSION_PATTERN.match(name):
+            return f"Error: Invalid extension reference '{name}'. Use a pip package name or a GitHub URL."
+
+        localstack_url = self._endpoint(endpoint)
+        try:
+            response = requests.post(
+                f"{localstack_url}/_localstack/extensions/install",
+                json={"name": name}
+            )
+            response.raise_for_status()
+            return response.text
+        except requests.RequestException as e:
+            return f"Error: Failed to install extension '{name}': {str(e)}"
+
+    @function
+    async def health(
+        self,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        retries: Annotated[int, Doc("Number of attempts while LocalStack is still starting up")] = 10
+    ) -> HealthStatus:
+        """Get the health of a running LocalStack instance and its services."""
+        health = await self._get_health(self._endpoint(endpoint), retries)
+
+        return HealthStatus(
+            edition=health.get("edition", ""),
+            version=health.get("version", ""),
+            services=[
+                ServiceStatus(name=name, status=status)
+                for name, status in health.get("services", {}).items()
+            ],
+        )
+
+    @function
+    async def services(
+        self,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None
+    ) -> list[str]:
+        """Get the services a running LocalStack instance has enabled, including ones it enables on its own."""
+        health = await self._get_health(self._endpoint(endpoint))
+        return sorted(
+            name for name, status in health.get("services", {}).items()
+            if status != "disabled"
+        )
+
+    @function
+    async def wait_for_services(
+        self,
+        services: Annotated[list[str], Doc("Names of the services to wait for (e.g. s3, sqs)")],
+        timeout: Annotated[int, Doc("Seconds to wait for the services to become ready")] = 60,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None
+    ) -> str:
+        """Wait until the given services of a running LocalStack instance are ready."""
+        localstack_url = self._endpoint(endpoint)
+        deadline = time.monotonic() + timeout
+        pending = list(services)
+
+        while True:
+            try:
+                health = await self._get_health(localstack_url)
+                statuses = health.get("services", {})
+                pending = [
+                    service for service in services
+                    if statuses.get(service) not in ("running", "available")
+                ]
+            except Exception:
+                pass
+
+            if not pending:
+                return f"Services ready: {', '.join(services)}"
+
+            if time.monotonic() >= deadline:
+                raise StartupTimeoutError(f"Timed out after {timeout} seconds waiting for services: {', '.join(pending)}")
+
+            await asyncio.sleep(1)
+
+    @function
+    async def endpoints(
+        self,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        extra_ports: Annotated[Optional[list[int]], Doc("Additional ports exposed with start, listed as port-<number>")] = None,
+        external_service_ports: Annotated[Optional[str], Doc("Port range passed to start, listed as external-<number>")] = None
+    ) -> list[ServiceEndpoint]:
+        """Get the URL of every service of a running LocalStack instance."""
+        localstack_url = self._endpoint(endpoint).rstrip("/")
+        health = await self._get_health(localstack_url)
+
+        # All services are served by the gateway
+        endpoints = [
+            ServiceEndpoint(name=name, url=localstack_url)
+            for name in health.get("services", {})
+        ]
+
+        # Additional ports are served on the same host
+        parsed = urlparse(localstack_url)
+        for port in extra_ports or []:
+            endpoints.append(ServiceEndpoint(name=f"port-{port}", url=f"{parsed.scheme}://{parsed.hostname}:{port}"))
+
+        # Ports of the external service port range are assigned to resources
+        # (e.g. a database instance) as they are created
+        if external_service_ports:
+            for port in self._port_range(external_service_ports):
+                endpoints.append(ServiceEndpoint(name=f"external-{port}", url=f"{parsed.scheme}://{parsed.hostname}:{port}"))
+
+        return endpoints
+
+    @function
+    async def inspect(
+        self,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to the endpoint of service, or host.docker.internal:4566)")] = None,
+        service: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start, to report its image, exposed ports, and name")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance to report the image, exposed ports, and name of, instead of service")] = None
+    ) -> InstanceInfo:
+        """Get the version, edition, enabled services, image, exposed ports, uptime, and name of a running LocalStack instance."""
+        if service and not endpoint:
+            endpoint = await service.endpoint(scheme="http")
+        localstack_url = self._endpoint(endpoint)
+        try:
+            info_response = requests.get(f"{localstack_url}/_localstack/info")
+            info_response.raise_for_status()
+            info = info_response.json()
+        except requests.RequestException as e:
+            raise Exception(f"LocalStack is not running at {localstack_url}: {str(e)}")
+
+        health = await self._get_health(localstack_url)
+
+        config = await self._get_config(localstack_url)
+
+        # The image, exposed ports, and name are only known for instances
+        # started with start, which records them in the instance's logs
+        # volume. LocalStack only reports its configuration with DEBUG=1.
+        metadata = {}
+        if service or instance_name:
+            metadata = await self._instance_metadata(await self._instance(service, instance_name))
+
+        return InstanceInfo(
+            version=info.get("version", ""),
+            edition=info.get("edition", health.get("edition", "")),
+            services=[
+                name for name, status in health.get("services", {}).items()
+                if status in ("running", "available")
+            ],
+            image=metadata.get("image", ""),
+            ports=metadata.get("ports", []),
+            uptime=int(info.get("uptime") or 0),
+            name=metadata.get("name") or config.get("MAIN_CONTAINER_NAME", ""),
+        )
+
+    @function
+    async def credentials(
+        self,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to the endpoint of service, or host.docker.internal:4566)")] = None,
+        region: Annotated[Optional[str], Doc("AWS region to use (defaults to the region of the instance)")] = None,
+        service: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start, to report its configured credentials and region")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance to report the configured credentials and region of, instead of service")] = None
+    ) -> Credentials:
+        """Get the credentials, region, and endpoint AWS clients need to talk to a running LocalStack instance."""
+        localstack_url = await self.unified_endpoint(service=service, endpoint=endpoint)
+
+        # Instances started with start record their settings, others only
+        # report them with DEBUG=1 or ENABLE_CONFIG_UPDATES=1
+        if service or instance_name:
+            settings = await self._instance_metadata(await self._instance(service, instance_name))
+        else:
+            config = await self._get_config(localstack_url)
+            if not config:
+                raise Exception(
+                    f"The instance at {localstack_url} doesn't report its configuration, "
+                    "pass the service returned by start or its instance_name, or start it with debug"
+                )
+            settings = {
+                "access_key_id": config.get("TEST_AWS_ACCESS_KEY_ID") or "test",
+                "secret_access_key": config.get("TEST_AWS_SECRET_ACCESS_KEY") or "test",
+                "region": config.get("DEFAULT_REGION") or DEFAULT_REGION,
+            }
+
+        return Credentials(
+            access_key_id=settings["access_key_id"],
+            secret_access_key=settings["secret_access_key"],
+            region=region or settings["region"],
+            endpoint=localstack_url,
+        )
+
+    @function
+    async def unified_endpoint(
+        self,
+        service: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start")] = None,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None
+    ) -> str:
+        """Get the value for AWS_ENDPOINT_URL, the single endpoint setting honored by current AWS SDKs and the AWS CLI."""
+        if service:
+            return await service.endpoint(scheme="http")
+
+        localstack_url = self._endpoint(endpoint).rstrip("/")
+        if "://" not in localstack_url:
+            localstack_url = f"http://{localstack_url}"
+        return localstack_url
+
+    @function
+    async def env_for_clients(
+        self,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to the endpoint of service, or host.docker.internal:4566)")] = None,
+        region: Annotated[Optional[str], Doc("AWS region to use (defaults to the region of the instance)")] = None,
+        service: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start, to report its configured credentials and region")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance to report the configured credentials and region of, instead of service")] = None
+    ) -> list[ClientEnvVariable]:
+        """Get the environment variables that point AWS clients in other containers at a running LocalStack instance."""
+        credentials = await self.credentials(endpoint=endpoint, region=region, service=service, instance_name=instance_name)
+
+        return [
+            ClientEnvVariable(name="AWS_ENDPOINT_URL", value=credentials.endpoint),
+            ClientEnvVariable(name="AWS_ACCESS_KEY_ID", value=credentials.access_key_id),
+            ClientEnvVariable(name="AWS_SECRET_ACCESS_KEY", value=credentials.secret_access_key),
+            ClientEnvVariable(name="AWS_DEFAULT_REGION", value=credentials.region),
+        ]
+
+    @function
+    async def config_dump(
+        self,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None
+    ) -> list[ConfigEntry]:
+        """Get the effective configuration of a running LocalStack instance, with secret values redacted."""
+        localstack_url = self._endpoint(endpoint)
+        config = await self._get_config(localstack_url)
+        if not config:
+            raise Exception(
+                f"LocalStack at {localstack_url} does not report its configuration. "
+                "Start it with debug or ENABLE_CONFIG_UPDATES=1."
+            )
+
+        entries = []
+        for key, value in sorted(config.items()):
+            if SECRET_CONFIG_PATTERN.search(key) and value:
+                value = "********"
+            elif not isinstance(value, str):
+                value = json.dumps(value)
+            entries.append(ConfigEntry(key=key, value=value))
+
+        return entries
+
+    @function
+    async def require_version(
+        self,
+        constraint: Annotated[str, Doc("Comma-separated version constraints, e.g. '>=3.5.0' or '>=3.5,<5'")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None
+    ) -> str:
+        """Check that the version of a running LocalStack instance meets a constraint, failing if it doesn't."""
+        localstack_url = self._endpoint(endpoint)
+        try:
+            info_response = requests.get(f"{localstack_url}/_localstack/info")
+            info_response.raise_for_status()
+            version = info_response.json().get("version", "")
+        except (requests.RequestException, ValueError) as e:
+            raise Exception(f"LocalStack is not running at {localstack_url}: {str(e)}")
+
+        # Compare the release part only, e.g. 3.8.2 of 3.8.2.dev33
+        match = re.match(r"^v?(\d+(?:\.\d+){0,2})", version)
+        if not match:
+            raise Exception(f"Could not parse the LocalStack version '{version}'")
+        current = self._version_tuple(match.group(1))
+
+        compare = {
+            ">=": lambda a, b: a >= b,
+            "<=": lambda a, b: a <= b,
+            ">": lambda a, b: a > b,
+            "<": lambda a, b: a < b,
+            "==": lambda a, b: a == b,
+            "=": lambda a, b: a == b,
+            "!=": lambda a, b: a != b,
+        }
+        for part in constraint.split(","):
+            parsed = VERSION_CONSTRAINT_PATTERN.match(part.strip())
+            if not parsed:
+                raise ValueError(f"Invalid version constraint '{part.strip()}'")
+            operator, required = parsed.group(1) or "==", parsed.group(2)
+            if not compare[operator](current, self._version_tuple(required)):
+                raise Exception(f"LocalStack {version} does not satisfy the version constraint '{constraint}'")
+
+        return f"LocalStack {version} satisfies '{constraint}'"
+
+    def _version_tuple(self, version: str) -> tuple[int, int, int]:
+        """Turn a version like 3.5 into a comparable (3, 5, 0) tuple."""
+        parts = [int(part) for part in version.split(".")]
+        return tuple(parts + [0] * (3 - len(parts)))
+
+    @function
+    async def metrics(
+        self,
+        service: Annotated[Optional[str], Doc("Only return the calls made to this service")] = None,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None
+    ) -> list[ApiCallCount]:
+        """Get the number of API calls per service and operation made to a running LocalStack instance."""
+        localstack_url = self._endpoint(endpoint)
+        try:
+            response = requests.get(f"{localstack_url}/_localstack/usage")
+            if response.status_code == 404:
+                # Older versions only report usage as part of the diagnostics
+                response = requests.get(f"{localstack_url}/_localstack/diagnose")
+                response.raise_for_status()
+                usage = response.json().get("usage", {})
+            else:
+                response.raise_for_status()
+                usage = response.json()
+        except requests.RequestException as e:
+            raise Exception(f"Failed to get usage metrics from {localstack_url}: {str(e)}")
+
+        counts = []
+        for service_name, operations in usage.items():
+            if service and service_name != service:
+                continue
+            if not isinstance(operations, dict):
+                continue
+            for operation, count in operations.items():
+                if isinstance(count, dict):
+                    count = count.get("count", 0)
+                counts.append(ApiCallCount(service=service_name, operation=operation, count=int(count or 0)))
+
+        return counts
+
+    @function
+    async def diagnose(
+        self,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None
+    ) -> dagger.File:
+        """Collect the diagnostics bundle of a running LocalStack instance as a JSON file."""
+        localstack_url = self._endpoint(endpoint)
+        try:
+            response = requests.get(f"{localstack_url}/_localstack/diagnose")
+            response.raise_for_status()
+            bundle = response.json()
+        except (requests.RequestException, ValueError) as e:
+            # The diagnose endpoint needs DEBUG=1, capture whatever else is available
+            bundle = {"error": f"Diagnose endpoint not available: {str(e)}"}
+            for name in ("info", "health"):
+                try:
+                    bundle[name] = requests.get(f"{localstack_url}/_localstack/{name}").json()
+                except (requests.RequestException, ValueError) as e:
+                    bundle[name] = {"error": str(e)}
+
+        return dag.directory().with_new_file("diagnose.json", json.dumps(bundle, indent=2)).file("diagnose.json")
+
+    async def _get_config(self, localstack_url: str) -> dict:
+        """Get the configuration of a running instance, empty if it isn't reported."""
+        # The configuration is reported by the config endpoint with
+        # ENABLE_CONFIG_UPDATES=1, and by the diagnose endpoint with DEBUG=1
+        try:
+            response = requests.get(f"{localstack_url}/_localstack/config")
+            if response.ok and isinstance(response.json(), dict):
+                return response.json()
+        except (requests.RequestException, ValueError):
+            pass
+
+        try:
+            return requests.get(f"{localstack_url}/_localstack/diagnose").json().get("config", {})
+        except (requests.RequestException, ValueError, AttributeError):
+            return {}
+
+    async def _get_health(self, localstack_url: str, retries: int = 1) -> dict:
+        """Fetch /_localstack/health, retrying on connection errors and 5xx responses."""
+        last_error = None
+        for attempt in range(max(retries, 1)):
+            if attempt:
+                await asyncio.sleep(1)
+            try:
+                response = requests.get(f"{localstack_url}/_localstack/health")
+                response.raise_for_status()
+                return response.json()
+            except requests.HTTPError as e:
+                # Client errors won't go away by retrying
+                if e.response is not None and e.response.status_code < 500:
+                    raise
+                last_error = e
+            except requests.RequestException as e:
+                last_error = e
+
+        raise Exception(f"LocalStack is not healthy at {localstack_url}: {str(last_error)}")
+
+    @function
+    async def stop(
+        self,
+        service: Annotated[dagger.Service, Doc("LocalStack service returned by start")],
+        grace_period: Annotated[int, Doc("Seconds to wait for a graceful shutdown before killing the container")] = 10
+    ) -> StopResult:
+        """Stop a running LocalStack service, killing it if it does not shut down in time."""
+        # Remember how far the logs went, so only the shutdown output is returned
+        instance = await self._instance(service)
+        try:
+            seen = len(await self._log_lines(instance))
+        except Exception:
+            seen = 0
+
+        # Send SIGTERM first so LocalStack can flush persisted state
+        graceful = True
+        try:
+            await asyncio.wait_for(service.stop(), timeout=grace_period)
+        except asyncio.TimeoutError:
+            graceful = False
+
+        # Force kill the container once the grace period is over
+        if not graceful:
+            try:
+                await service.stop(kill=True)
+            except Exception as e:
+                raise Exception(f"Failed to stop LocalStack: {str(e)}")
+
+        try:
+            output = "\n".join((await self._log_lines(instance))[seen:])
+        except Exception:
+            output = ""
+        return StopResult(graceful=graceful, output=output)
+
+    @function
+    async def logs(
+        self,
+        service: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance, instead of service")] = None,
+        follow: Annotated[bool, Doc("Keep collecting new log lines until the timeout elapses")] = False,
+        tail: Annotated[Optional[int], Doc("Only return the last N log lines")] = None,
+        since: Annotated[Optional[str], Doc("Only return log lines at or after this timestamp (e.g. '2024-01-01T12:00:00')")] = None,
+        timeout: Annotated[int, Doc("Seconds to follow the logs for (only with follow)")] = 60
+    ) -> str:
+        """Retrieve the logs of a LocalStack service started with start."""
+        if self.attached_endpoint:
+            raise Exception("Logs are not available for an attached instance, they are only collected for instances started with start.")
+        instance = await self._instance(service, instance_name)
+        lines = await self._log_lines(instance, follow, timeout)
+
+        # LocalStack log lines start with an ISO timestamp, so a string
+        # comparison is enough to filter them
+        if since:
+            lines = [line for line in lines if line[:len(since)] >= since]
+
+        if tail:
+            lines = lines[-tail:]
+
+        return "\n".join(lines) if lines else "No log content available."
+
+    async def _log_lines(self, instance: str, follow: bool = False, timeout: int = 60) -> list[str]:
+        """Read the raw log lines of an instance."""
+        # LocalStack writes its output to /var/lib/localstack/logs, which start
+        # mounts from a cache volume of the instance that we can read from a
+        # separate container
+        command = "cat /logs/localstack_infra.log /logs/localstack_infra.err 2>/dev/null; true"
+        if follow:
+            command = f"timeout {timeout} tail -n +1 -F /logs/localstack_infra.log 2>/dev/null; true"
+
+        try:
+            output = await (
+                dag.container()
+                .from_("python:3.9-slim")
+                .with_mounted_cache("/logs", self._logs_volume(instance))
+                .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+                .with_exec(["sh", "-c", command])
+                .stdout()
+            )
+        except Exception as e:
+            raise Exception(f"Failed to read LocalStack logs: {str(e)}")
+
+        return output.splitlines()
+
+    @function
+    async def service_logs(
+        self,
+        service: Annotated[str, Doc("Service to return the log lines of (e.g. s3)")],
+        localstack: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance, instead of localstack")] = None,
+        grep: Annotated[Optional[str], Doc("Only return lines matching this regular expression")] = None,
+        tail: Annotated[Optional[int], Doc("Only return the last N matching lines")] = None
+    ) -> str:
+        """Retrieve the log lines of a single service of a LocalStack service started with start."""
+        logs = await self.logs(service=localstack, instance_name=instance_name)
+
+        try:
+            pattern = re.compile(grep) if grep else None
+        except re.error as e:
+            return f"Error: Invalid grep pattern '{grep}': {str(e)}"
+
+        # Lines are attributed to a service through its request lines and the
+        # loggers of its provider, e.g. localstack.services.s3.provider
+        markers = (f"AWS {service}.", f".services.{service}.", f".services.{service} ")
+        lines = [
+            line for line in logs.splitlines()
+            if any(marker in line for marker in markers) and (not pattern or pattern.search(line))
+        ]
+
+        if tail:
+            lines = lines[-tail:]
+
+        return "\n".join(lines) if lines else f"No log lines for service '{service}'."
+
+    @function
+    async def events(
+        self,
+        localstack: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance, instead of localstack")] = None,
+        service: Annotated[Optional[str], Doc("Only return calls made to this service")] = None,
+        count: Annotated[Optional[int], Doc("Stop after this many events")] = None,
+        timeout: Annotated[int, Doc("Seconds to wait for new events")] = 60
+    ) -> list[ApiEvent]:
+        """Follow the AWS API calls handled by a LocalStack service started with start."""
+        if self.attached_endpoint:
+            raise Exception("Events are not available for an attached instance, they are read from the logs of instances started with start.")
+        instance = await self._instance(localstack, instance_name)
+
+        # LocalStack has no event stream to subscribe to, so follow the request
+        # log lines it writes to the logs cache volume instead
+        if service and not re.fullmatch(r"[a-z0-9-]+", service):
+            raise ValueError(f"Invalid service name '{service}'")
+        pattern = rf"AWS {service or '[a-z0-9-]+'}\."
+        command = f"timeout {timeout} tail -n +1 -F /logs/localstack_infra.log 2>/dev/null | grep --line-buffered -E '{pattern}'"
+        if count:
+            command += f" | head -n {count}"
+
+        output = await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_cache("/logs", self._logs_volume(instance))
+            .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+            .with_exec(["sh", "-c", f"{command}; true"])
+            .stdout()
+        )
+
+        events = []
+        for line in output.splitlines():
+            match = API_EVENT_PATTERN.match(line)
+            if match:
+                timestamp, service_name, operation, status = match.groups()
+                events.append(ApiEvent(timestamp=timestamp, service=service_name, operation=operation, status=int(status)))
+
+        return events
+
+    @function
+    async def restart(
+        self,
+        service: Annotated[dagger.Service, Doc("LocalStack service returned by start")],
+        clear_persistence: Annotated[bool, Doc("Remove the persisted state before starting again")] = False
+    ) -> str:
+        """Restart a LocalStack service with the same configuration and return its endpoint."""
+        instance = await self._instance(service)
+        try:
+            await service.stop()
+        except Exception as e:
+            raise Exception(f"Failed to stop LocalStack: {str(e)}")
+
+        # Wipe the state volume of this instance for a clean slate
+        if clear_persistence:
+            await (
+                dag.container()
+                .from_("python:3.9-slim")
+                .with_mounted_cache("/state", self._state_volume(instance))
+                .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+                .with_exec(["find", "/state", "-mindepth", "1", "-delete"])
+                .sync()
+            )
+
+        # The service keeps its hostname, so the endpoint is stable across restarts
+        try:
+            await service.start()
+            return await service.endpoint(scheme="http")
+        except Exception as e:
+            raise Exception(f"Failed to start LocalStack: {str(e)}")
+
+    @function
+    async def export_state(
+        self,
+        service: Annotated[dagger.Service, Doc("LocalStack service returned by start with persist")]
+    ) -> dagger.Directory:
+        """Export the persisted state of a LocalStack service as a directory, e.g. to cache it for a later start."""
+        volume = self._state_volume(await self._instance(service))
+
+        # Stop the service so LocalStack flushes its state and nothing is
+        # written while it is copied
+        await service.stop()
+        try:
+            export = await (
+                dag.container()
+                .from_("python:3.9-slim")
+                .with_mounted_cache("/state", volume)
+                .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+                .with_exec(["sh", "-c", "mkdir /export && cp -a /state/. /export/ && rm -rf /export/logs"], expect=dagger.ReturnType.ANY)
+            )
+            if await export.exit_code() != 0:
+                raise Exception(f"Failed to export the persisted state: {(await export.stderr()).strip()}")
+            state = export.directory("/export")
+            if "state" not in [entry.rstrip("/") for entry in await state.entries()]:
+                raise PersistenceRequiredError("The service has no persisted state, start it with persist to export its state")
+        finally:
+            await service.start()
+
+        return state
+
+    @function
+    async def snapshot(
+        self,
+        service: Annotated[dagger.Service, Doc("LocalStack service returned by start with persist")]
+    ) -> dagger.File:
+        """Save the persisted state of a LocalStack service as a tarball, without Cloud Pods."""
+        volume = self._state_volume(await self._instance(service))
+
+        # Stop the service so LocalStack flushes its state and nothing is
+        # written while the archive is created
+        await service.stop()
+        try:
+            snapshot = await (
+                dag.container()
+                .from_("python:3.9-slim")
+                .with_mounted_cache("/state", volume)
+                .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+                .with_exec(["sh", "-c", "test -d /state/state && tar -czf /tmp/snapshot.tar.gz -C /state --exclude=./logs ."], expect=dagger.ReturnType.ANY)
+            )
+            if await snapshot.exit_code() != 0:
+                raise PersistenceRequiredError("The service has no persisted state, start it with persist to take snapshots")
+            archive = await snapshot.file("/tmp/snapshot.tar.gz").sync()
+        finally:
+            await service.start()
+
+        return archive
+
+    @function
+    async def sync_persistence(
+        self,
+        service: Annotated[dagger.Service, Doc("LocalStack service returned by start with persistence_backend=s3")],
+        s3_uri: Annotated[str, Doc("S3 location of the persisted state, e.g. s3://bucket/prefix")],
+        access_key_id: Annotated[dagger.Secret, Doc("AWS access key ID for s3_uri")],
+        secret_access_key: Annotated[dagger.Secret, Doc("AWS secret access key for s3_uri")]
+    ) -> str:
+        """Upload the persisted state of a LocalStack service to S3."""
+        if not s3_uri.startswith("s3://"):
+            raise ValueError(f"Invalid S3 URI '{s3_uri}', expected s3://bucket/prefix")
+
+        instance = await self._instance(service)
+
+        # Stop the service so LocalStack flushes its state and nothing is
+        # written while it is uploaded
+        await service.stop()
+        try:
+            result = await (
+                self._persistence_container(instance, access_key_id, secret_access_key)
+                .with_exec(["aws", "s3", "sync", "/state", s3_uri, "--delete", "--exclude", "logs/*"], expect=dagger.ReturnType.ANY)
+            )
+            if await result.exit_code() != 0:
+                raise Exception(f"Failed to upload the persisted state: {(await result.stderr()).strip()}")
+        finally:
+            await service.start()
+
+        return f"Persisted state uploaded to {s3_uri}"
+
+    def _persistence_container(self, instance: str, access_key_id: dagger.Secret, secret_access_key: dagger.Secret) -> dagger.Container:
+        """AWS CLI container with the persisted state volume of an instance mounted at /state."""
+        return (
+            dag.container()
+            .from_("amazon/aws-cli:latest")
+            .with_mounted_cache("/state", self._state_volume(instance))
+            .with_secret_variable("AWS_ACCESS_KEY_ID", access_key_id)
+            .with_secret_variable("AWS_SECRET_ACCESS_KEY", secret_access_key)
+            .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+        )
+
+    @function
+    async def restore(
+        self,
+        service: Annotated[dagger.Service, Doc("LocalStack service returned by start with persist")],
+        snapshot: Annotated[dagger.File, Doc("Tarball created with snapshot")]
+    ) -> str:
+        """Replace the persisted state of a LocalStack service with a snapshot and return its endpoint."""
+        # Check the archive before touching the current state
+        entries = await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_file("/tmp/snapshot.tar.gz", snapshot)
+            .with_exec(["tar", "-tzf", "/tmp/snapshot.tar.gz"], expect=dagger.ReturnType.ANY)
+        )
+        if await entries.exit_code() != 0:
+            raise ValueError("The file is not a valid snapshot archive")
+        if not any(entry.startswith("./state/") for entry in (await entries.stdout()).splitlines()):
+            raise ValueError("The snapshot does not contain a LocalStack persistence directory: missing state/")
+
+        # Replace the state of the instance the service belongs to, which only
+        # has a state volume if it was started with persist
+        volume = self._state_volume(await self._instance(service))
+        persisted = await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_cache("/state", volume)
+            .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+            .with_exec(["test", "-d", "/state/state"], expect=dagger.ReturnType.ANY)
+            .exit_code()
+        )
+        if persisted != 0:
+            raise PersistenceRequiredError("The service has no persisted state, start it with persist to restore snapshots")
+
+        try:
+            await service.stop()
+        except Exception as e:
+            raise Exception(f"Failed to stop LocalStack: {str(e)}")
+
+        await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_cache("/state", volume)
+            .with_mounted_file("/tmp/snapshot.tar.gz", snapshot)
+            .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+            .with_exec(["sh", "-c", "find /state -mindepth 1 -delete && tar -xzf /tmp/snapshot.tar.gz -C /state"])
+            .sync()
+        )
+
+        try:
+            await service.start()
+            return await service.endpoint(scheme="http")
+        except Exception as e:
+            raise Exception(f"Failed to start LocalStack: {str(e)}")
+
+    @function
+    async def exec(
+        self,
+        args: Annotated[list[str], Doc("Command to run (e.g. ls /var/lib/localstack)")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to the endpoint of service, or host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION,
+        service: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start, whose data directory and logs are mounted")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance whose data directory and logs are mounted, instead of service")] = None
+    ) -> ExecResult:
+        """Run a command next to a running LocalStack instance, with its data directory and logs mounted if it was started with start."""
+        if service and not endpoint:
+            endpoint = await service.endpoint(scheme="http")
+        container = self._client_container(self._endpoint(endpoint), region)
+
+        # Mount the volumes of the instance the same way start does, so the
+        # command sees its data directory and logs
+        if service or instance_name:
+            instance = await self._instance(service, instance_name)
+            container = (
+                container
+                .with_mounted_cache("/var/lib/localstack", self._state_volume(instance))
+                .with_mounted_cache("/var/lib/localstack/logs", self._logs_volume(instance))
+            )
+        if service:
+            container = container.with_service_binding(await service.hostname(), service)
+
+        container = container.with_exec(args, expect=dagger.ReturnType.ANY)
+
+        stdout = await container.stdout()
+        stderr = await container.stderr()
+        return ExecResult(output=stdout + stderr, exit_code=await container.exit_code())
+
+    @function
+    async def wait_for_resource(
+        self,
+        service: Annotated[str, Doc("Service of the resource (e.g. sqs)")],
+        resource_type: Annotated[str, Doc("Type of the resource (e.g. queue)")],
+        identifier: Annotated[str, Doc("Name, ARN, or ID of the resource, as accepted by its describe API")],
+        timeout: Annotated[int, Doc("Seconds to wait for the resource to exist")] = 60,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Wait until a resource exists in a running LocalStack instance and return its description."""
+        describe = RESOURCE_DESCRIBE_COMMANDS.get((service, resource_type))
+        if not describe:
+            supported = ", ".join(f"{service_name}/{type_name}" for service_name, type_name in RESOURCE_DESCRIBE_COMMANDS)
+            raise ValueError(f"Unsupported resource type '{service}/{resource_type}'. Supported types are: {supported}")
+
+        container = self._client_container(self._endpoint(endpoint), region)
+        deadline = time.monotonic() + timeout
+        attempt = 0
+        while True:
+            # A new attempt number keeps the exec from being cached
+            attempt += 1
+            result = (
+                container
+                .with_env_variable("ATTEMPT", str(attempt))
+                .with_exec(["awslocal", *describe, identifier], expect=dagger.ReturnType.ANY)
+            )
+            if await result.exit_code() == 0:
+                return await result.stdout()
+
+            if time.monotonic() >= deadline:
+                raise Exception(
+                    f"Timed out after {timeout} seconds waiting for {service} {resource_type} '{identifier}'. "
+                    f"Last response: {(await result.stderr()).strip()}"
+                )
+
+            await asyncio.sleep(1)
+
+    @function
+    async def run_when_ready(
+        self,
+        services: Annotated[list[str], Doc("Names of the services to wait for (e.g. s3, sqs)")],
+        args: Annotated[list[str], Doc("Command to run once the services are ready")],
+        timeout: Annotated[int, Doc("Seconds to wait for the services to become ready")] = 60,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to the endpoint of service, or host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION,
+        service: Annotated[Optional[dagger.Service], Doc("LocalStack service returned by start, whose data directory and logs are mounted")] = None,
+        instance_name: Annotated[Optional[str], Doc("Name of the instance whose data directory and logs are mounted, instead of service")] = None
+    ) -> ExecResult:
+        """Wait until the given services of a running LocalStack instance are ready, then run a command next to it."""
+        if service and not endpoint:
+            endpoint = await service.endpoint(scheme="http")
+        await self.wait_for_services(services=services, timeout=timeout, endpoint=endpoint)
+        return await self.exec(args=args, endpoint=endpoint, region=region, service=service, instance_name=instance_name)
+
+    @function
+    async def awslocal(
+        self,
+        args: Annotated[list[str], Doc("Arguments for the awslocal CLI (e.g. s3 ls)")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Run an awslocal command against a running LocalStack instance."""
+        container = (
+            self._client_container(self._endpoint(endpoint), region)
+            .with_exec(["awslocal", *args], expect=dagger.ReturnType.ANY)
+        )
+        if await container.exit_code() != 0:
+            stderr = await container.stderr()
+            self._raise_if_not_enabled(stderr)
+            raise Exception(f"'awslocal {' '.join(args)}' failed: {stderr.strip()}")
+
+        return await container.stdout()
+
+    @function
+    async def invoke_lambda(
+        self,
+        name: Annotated[str, Doc("Name or ARN of the Lambda function")],
+        payload: Annotated[Optional[dagger.File], Doc("JSON event to invoke the function with")] = None,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> LambdaResult:
+        """Invoke a Lambda function deployed to a running LocalStack instance and return its response."""
+        container = self._client_container(self._endpoint(endpoint), region)
+        args = ["awslocal", "lambda", "invoke", "--function-name", name, "--output", "json"]
+        if payload:
+            container = container.with_mounted_file("/tmp/payload.json", payload)
+            args += ["--payload", "fileb:///tmp/payload.json"]
+        args.append("/tmp/response.json")
+
+        # A failing invocation exits non-zero, while errors raised by the
+        # function itself are reported in FunctionError
+        invocation = container.with_exec(args, expect=dagger.ReturnType.ANY)
+        if await invocation.exit_code() != 0:
+            raise Exception(f"Failed to invoke Lambda function '{name}': {await invocation.stderr()}")
+
+        result = json.loads(await invocation.stdout())
+        return LambdaResult(
+            payload=await invocation.file("/tmp/response.json").contents(),
+            status_code=int(result.get("StatusCode", 0)),
+            function_error=result.get("FunctionError", ""),
+        )
+
+    @function
+    async def create_execution_role(
+        self,
+        name: Annotated[str, Doc("Name of the role")],
+        policy_arns: Annotated[Optional[list[str]], Doc("ARNs of managed policies to attach")] = None,
+        policies: Annotated[Optional[list[dagger.File]], Doc("JSON policy documents to add as inline policies")] = None,
+        trusted_services: Annotated[Optional[list[str]], Doc("Service principals allowed to assume the role (defaults to lambda.amazonaws.com)")] = None,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Create an IAM execution role on a running LocalStack instance and return its ARN."""
+        trust_policy = {
+            "Version": "2012-10-17",
+            "Statement": [{
+                "Effect": "Allow",
+                "Principal": {"Service": trusted_services or ["lambda.amazonaws.com"]},
+                "Action": "sts:AssumeRole",
+            }],
+        }
+        container = (
+            self._client_container(self._endpoint(endpoint), region)
+            .with_new_file("/tmp/trust-policy.json", json.dumps(trust_policy))
+        )
+
+        role = container.with_exec([
+            "awslocal", "iam", "create-role",
+            "--role-name", name,
+            "--assume-role-policy-document", "file:///tmp/trust-policy.json",
+            "--query", "Role.Arn",
+            "--output", "text",
+        ], expect=dagger.ReturnType.ANY)
+        if await role.exit_code() != 0:
+            raise Exception(f"Failed to create role '{name}': {(await role.stderr()).strip()}")
+
+        # Attach managed policies by ARN and add the documents as inline policies
+        commands = [
+            ["awslocal", "iam", "attach-role-policy", "--role-name", name, "--policy-arn", arn]
+            for arn in policy_arns or []
+        ]
+        for index, policy in enumerate(policies or []):
+            container = container.with_mounted_file(f"/tmp/policies/{index}.json", policy)
+            commands.append([
+                "awslocal", "iam", "put-role-policy",
+                "--role-name", name,
+                "--policy-name", f"{name}-policy-{index}",
+                "--policy-document", f"file:///tmp/policies/{index}.json",
+            ])
+        await self._run_commands(container, commands)
+
+        return (await role.stdout()).strip()
+
+    @function
+    async def trigger_schedule(
+        self,
+        rule_name: Annotated[str, Doc("Name of the scheduled EventBridge rule")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> list[TriggeredTarget]:
+        """Fire a scheduled EventBridge rule right away and return the targets it was delivered to."""
+        # LocalStack has no API to fire a schedule, so copy the targets to a
+        # temporary rule matching a unique source and send it a scheduled event
+        script = (
+            "import json, os, sys, uuid, boto3\n"
+            "events = boto3.client('events', endpoint_url=os.environ['AWS_ENDPOINT_URL'])\n"
+            "name = sys.argv[1]\n"
+            "try:\n"
+            "    rule = events.describe_rule(Name=name)\n"
+            "except events.exceptions.ResourceNotFoundException:\n"
+            "    sys.exit(f\"Rule '{name}' does not exist\")\n"
+            "if not rule.get('ScheduleExpression'):\n"
+            "    sys.exit(f\"Rule '{name}' has no schedule expression\")\n"
+            "targets = events.list_targets_by_rule(Rule=name)['Targets']\n"
+            "suffix = uuid.uuid4().hex[:8]\n"
+            "source = f'localstack.trigger-schedule.{suffix}'\n"
+            "temporary = f'{name[:46]}-trigger-{suffix}'\n"
+            "events.put_rule(Name=temporary, EventPattern=json.dumps({'source': [source]}))\n"
+            "try:\n"
+            "    failed = {}\n"
+            "    if targets:\n"
+            "        response = events.put_targets(Rule=temporary, Targets=targets)\n"
+            "        failed = {entry['TargetId']: entry.get('ErrorMessage', 'failed') for entry in response.get('FailedEntries', [])}\n"
+            "    entry = events.put_events(Entries=[{'Source': source, 'DetailType': 'Scheduled Event', 'Detail': '{}', 'Resources': [rule['Arn']]}])['Entries'][0]\n"
+            "    if entry.get('ErrorCode'):\n"
+            "        sys.exit(f\"Failed to send the event: {entry.get('ErrorMessage', entry['ErrorCode'])}\")\n"
+            "finally:\n"
+            "    if targets:\n"
+            "        events.remove_targets(Rule=temporary, Ids=[target['Id'] for target in targets])\n"
+            "    events.delete_rule(Name=temporary)\n"
+            "print(json.dumps([{'id': t['Id'], 'arn': t['Arn'], 'error': failed.get(t['Id'], '')} for t in targets]))\n"
+        )
+        trigger = (
+            self._client_container(self._endpoint(endpoint), region)
+            .with_exec(["python", "-c", script, rule_name], expect=dagger.ReturnType.ANY)
+        )
+        if await trigger.exit_code() != 0:
+            raise Exception(f"Failed to trigger rule '{rule_name}': {(await trigger.stderr()).strip()}")
+
+        return [
+            TriggeredTarget(id=target["id"], arn=target["arn"], error=target["error"])
+            for target in json.loads(await trigger.stdout())
+        ]
+
+    @function
+    async def presign_s3(
+        self,
+        bucket: Annotated[str, Doc("Name of the bucket")],
+        key: Annotated[str, Doc("Key of the object")],
+        method: Annotated[str, Doc("HTTP method the URL is for: GET, PUT, DELETE, or HEAD")] = "GET",
+        expiry_seconds: Annotated[int, Doc("Seconds until the URL expires")] = 3600,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Create a presigned S3 URL pointing at a running LocalStack instance."""
+        client_method = PRESIGN_METHODS.get(method.upper())
+        if not client_method:
+            raise ValueError(f"Invalid method '{method}'. Supported methods are: {', '.join(PRESIGN_METHODS)}")
+
+        # Use path-style addressing, bucket subdomains of the endpoint don't resolve
+        script = (
+            "import os, sys, boto3\n"
+            "from botocore.config import Config\n"
+            "s3 = boto3.client('s3', endpoint_url=os.environ['AWS_ENDPOINT_URL'], config=Config(s3={'addressing_style': 'path'}))\n"
+            "print(s3.generate_presigned_url(sys.argv[1], Params={'Bucket': sys.argv[2], 'Key': sys.argv[3]}, ExpiresIn=int(sys.argv[4])))\n"
+        )
+        url = await (
+            self._client_container(self._endpoint(endpoint), region)
+            .with_exec(["python", "-c", script, client_method, bucket, key, str(expiry_seconds)])
+            .stdout()
+        )
+        return url.strip()
+
+    @function
+    async def send_sqs_message(
+        self,
+        queue_url: Annotated[str, Doc("URL of the SQS queue")],
+        body: Annotated[str, Doc("Body of the message")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Send a message to an SQS queue of a running LocalStack instance and return its message ID."""
+        message_id = await (
+            self._client_container(self._endpoint(endpoint), region)
+            .with_exec([
+                "awslocal", "sqs", "send-message",
+                "--queue-url", queue_url,
+                "--message-body", body,
+                "--query", "MessageId",
+                "--output", "text",
+            ])
+            .stdout()
+        )
+        return message_id.strip()
+
+    @function
+    async def put_kinesis_record(
+        self,
+        stream: Annotated[str, Doc("Name of the Kinesis stream")],
+        partition_key: Annotated[str, Doc("Partition key of the record")],
+        data: Annotated[dagger.File, Doc("Data of the record")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Put a record into a Kinesis stream of a running LocalStack instance and return its sequence number."""
+        sequence_number = await (
+            self._client_container(self._endpoint(endpoint), region)
+            .with_mounted_file("/tmp/record", data)
+            .with_exec([
+                "awslocal", "kinesis", "put-record",
+                "--stream-name", stream,
+                "--partition-key", partition_key,
+                "--data", "fileb:///tmp/record",
+                "--query", "SequenceNumber",
+                "--output", "text",
+            ])
+            .stdout()
+        )
+        return sequence_number.strip()
+
+    @function
+    async def tflocal(
+        self,
+        source: Annotated[dagger.Directory, Doc("Directory containing the Terraform configuration")],
+        command: Annotated[str, Doc("Terraform command to run after init (plan, apply, destroy)")] = "plan",
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Run a Terraform configuration against a running LocalStack instance using tflocal."""
+        if command not in ("plan", "apply", "destroy"):
+            raise ValueError(f"Invalid command '{command}'. Supported commands are: plan, apply, destroy")
+
+        args = ["tflocal", command, "-input=false"]
+        if command in ("apply", "destroy"):
+            args.append("-auto-approve")
+
+        container = (
+            dag.container()
+            .from_("hashicorp/terraform:latest")
+            .with_exec(["apk", "add", "--no-cache", "py3-pip"])
+            .with_exec(["pip", "install", "--break-system-packages", "terraform-local"])
+            .with_(self._with_aws_env(self._endpoint(endpoint), region))
+            .with_mounted_directory("/src", source)
+            .with_workdir("/src")
+        )
+
+        return await self._run_commands(container, [["tflocal", "init", "-input=false"], args])
+
     @function
-    def start(
+    async def samlocal(
         self,
-        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token for authentication")],
-        configuration: Annotated[Optional[str], Doc("Configuration variables in format 'KEY1=value1,KEY2=value2'")] = None,
-        docker_sock: Annotated[Optional[dagger.Socket], Doc("Docker socket for container interactions")] = None,
-        image_name: Annotated[Optional[str], Doc("Custom LocalStack image name to use")] = None
-    ) -> dagger.Service:
-        """Start a LocalStack service with appropriate configuration."""
-        # Determine image based on parameters
-        image = image_name if image_name else "localstack/localstack:latest"
+        source: Annotated[dagger.Directory, Doc("Directory containing the SAM application")],
+        command: Annotated[str, Doc("SAM command to run (build, deploy)")] = "deploy",
+        template_path: Annotated[Optional[str], Doc("Path of the SAM template relative to the source directory")] = None,
+        stack_name: Annotated[str, Doc("Name of the CloudFormation stack to deploy")] = "sam-app",
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Build or deploy a SAM application against a running LocalStack instance using samlocal."""
+        if command not in ("build", "deploy"):
+            raise ValueError(f"Invalid command '{command}'. Supported commands are: build, deploy")
 
-        # Start with base container config
-        container = dag.container().from_(image)
+        build = ["samlocal", "build"]
+        if template_path:
+            build.extend(["--template", template_path])
 
-        # Mount Docker socket if provided
-        if docker_sock:
-            container = container.with_unix_socket("/var/run/docker.sock", docker_sock)
+        commands = [build]
+        if command == "deploy":
+            commands.append([
+                "samlocal", "deploy",
+                "--stack-name", stack_name,
+                "--resolve-s3",
+                "--capabilities", "CAPABILITY_IAM", "CAPABILITY_AUTO_EXPAND",
+                "--no-confirm-changeset",
+                "--no-fail-on-empty-changeset",
+            ])
+            # Surface the stack outputs as part of the result
+            commands.append([
+                "awslocal", "cloudformation", "describe-stacks",
+                "--stack-name", stack_name,
+                "--query", "Stacks[0].Outputs",
+                "--output", "table",
+            ])
 
-        # Add Auth Token
-        container = container.with_secret_variable("LOCALSTACK_AUTH_TOKEN", auth_token)
+        container = (
+            dag.container()
+            .from_("python:3.12-slim")
+            .with_exec(["pip", "install", "aws-sam-cli", "aws-sam-cli-local", "awscli", "awscli-local"])
+            .with_(self._with_aws_env(self._endpoint(endpoint), region))
+            .with_mounted_directory("/src", source)
+            .with_workdir("/src")
+        )
 
-        # Add configuration variables if provided
-        if configuration:
-            for config_pair in configuration.split(','):
-                if '=' in config_pair:
-                    key, value = config_pair.strip().split('=', 1)
-                    container = container.with_env_variable(key, value)
+        return await self._run_commands(container, commands)
+
+    @function
+    async def cdklocal(
+        self,
+        source: Annotated[dagger.Directory, Doc("Directory containing the CDK application")],
+        command: Annotated[str, Doc("CDK command to run (synth, deploy)")] = "deploy",
+        language: Annotated[Optional[str], Doc("Language of the CDK application (typescript, python), detected from the project files if not set")] = None,
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Synthesize or deploy a CDK application against a running LocalStack instance using cdklocal."""
+        if command not in ("synth", "deploy"):
+            raise ValueError(f"Invalid command '{command}'. Supported commands are: synth, deploy")
+
+        # Detect the language from the project files
+        if not language:
+            entries = await source.entries()
+            if "package.json" in entries:
+                language = "typescript"
+            elif "requirements.txt" in entries or "setup.py" in entries:
+                language = "python"
+            else:
+                raise ValueError("Could not detect the CDK application language, please pass it explicitly")
+
+        container = (
+            dag.container()
+            .from_("node:20")
+            .with_exec(["npm", "install", "-g", "aws-cdk", "aws-cdk-local"])
+        )
+
+        if language == "typescript":
+            install = ["npm", "install"]
+        elif language == "python":
+            container = container.with_exec(["sh", "-c", "apt-get update && apt-get install -y python3-pip"])
+            install = ["pip", "install", "--break-system-packages", "-r", "requirements.txt"]
+        else:
+            raise ValueError(f"Invalid language '{language}'. Supported languages are: typescript, python")
 
-        # Add common ports (4566 and 443)
         container = (
             container
-            .with_exposed_port(4566)
-            .with_exposed_port(443)
+            .with_(self._with_aws_env(self._endpoint(endpoint), region))
+            .with_mounted_directory("/src", source)
+            .with_workdir("/src")
         )
 
-        # Return as service
-        return container.as_service()
+        commands = [install]
+        if command == "synth":
+            commands.append(["cdklocal", "synth"])
+        else:
+            commands.append(["cdklocal", "bootstrap"])
+            commands.append(["cdklocal", "deploy", "--all", "--require-approval", "never"])
+
+        return await self._run_commands(container, commands)
+
+    @function
+    async def seed(
+        self,
+        spec: Annotated[dagger.File, Doc("YAML file describing the buckets, queues, tables, parameters, and secrets to create")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> str:
+        """Create resources from a declarative YAML spec in a running LocalStack instance."""
+        localstack_url = self._endpoint(endpoint)
+        container = self._client_container(localstack_url, region)
+        resources = self._seed_commands(await self._read_yaml(container, spec), localstack_url)
+
+        # Create the resources one by one, rolling back on the first failure
+        created = []
+        for description, create, delete in resources:
+            result = container.with_exec(["awslocal", *create], expect=dagger.ReturnType.ANY)
+            if await result.exit_code() != 0:
+                error = await result.stderr()
+                for _, _, rollback in reversed(created):
+                    await container.with_exec(["awslocal", *rollback], expect=dagger.ReturnType.ANY).sync()
+                self._raise_if_not_enabled(error)
+                raise Exception(f"Failed to create {description}, rolled back {len(created)} resources: {error}")
+            created.append((description, create, delete))
+
+        return "\n".join(f"Created {description}" for description, _, _ in created) or "No resources to create."
+
+    @function
+    async def deploy_cloud_formation(
+        self,
+        template: Annotated[dagger.File, Doc("CloudFormation template to deploy")],
+        stack_name: Annotated[str, Doc("Name of the CloudFormation stack")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> list[StackOutput]:
+        """Deploy a CloudFormation template to a running LocalStack instance and return the stack outputs."""
+        container = (
+            self._client_container(self._endpoint(endpoint), region)
+            .with_mounted_file("/tmp/template.yaml", template)
+        )
+
+        # cloudformation deploy waits until the stack is complete
+        deploy = container.with_exec(
+            [
+                "awslocal", "cloudformation", "deploy",
+                "--template-file", "/tmp/template.yaml",
+                "--stack-name", stack_name,
+                "--capabilities", "CAPABILITY_IAM", "CAPABILITY_NAMED_IAM", "CAPABILITY_AUTO_EXPAND",
+                "--no-fail-on-empty-changeset",
+            ],
+            expect=dagger.ReturnType.ANY,
+        )
+        if await deploy.exit_code() != 0:
+            events = await container.with_exec(
+                [
+                    "awslocal", "cloudformation", "describe-stack-events",
+                    "--stack-name", stack_name,
+                    "--query", "StackEvents[].[LogicalResourceId,ResourceStatus,ResourceStatusReason]",
+                    "--output", "text",
+                ],
+                expect=dagger.ReturnType.ANY,
+            ).stdout()
+            raise Exception(f"Failed to deploy stack '{stack_name}': {await deploy.stderr()}\nStack events:\n{events}")
+
+        return await self._stack_outputs(container, stack_name)
+
+    @function
+    async def stack_outputs(
+        self,
+        stack_name: Annotated[str, Doc("Name of the CloudFormation stack")],
+        endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
+        region: Annotated[str, Doc("AWS region to use")] = DEFAULT_REGION
+    ) -> list[StackOutput]:
+        """Get the outputs of a CloudFormation stack deployed to a running LocalStack instance."""
+        return await self._stack_outputs(self._client_container(self._endpoint(endpoint), region), stack_name)
+
+    async def _stack_outputs(self, container: dagger.Container, stack_name: str) -> list[StackOutput]:
+        """Read the outputs of a CloudFormation stack."""
+        result = container.with_exec(
+            ["awslocal", "cloudformation", "describe-stacks", "--stack-name", stack_name, "--output", "json"],
+            expect=dagger.ReturnType.ANY,
+        )
+        if await result.exit_code() != 0:
+            raise Exception(f"Stack '{stack_name}' does not exist: {await result.stderr()}")
+
+        stacks = json.loads(await result.stdout()).get("Stacks", [])
+        outputs = stacks[0].get("Outputs", []) if stacks else []
+        return [StackOutput(key=output["OutputKey"], value=output["OutputValue"]) for output in outputs]
+
+    async def _read_yaml(self, container: dagger.Container, file: dagger.File):
+        """Parse a YAML file with the PyYAML shipped in the LocalStack image."""
+        output = await (
+            container
+            .with_mounted_file("/tmp/spec.yaml", file)
+            .with_exec(["python", "-c", "import json, yaml; print(json.dumps(yaml.safe_load(open('/tmp/spec.yaml'))))"])
+            .stdout()
+        )
+        return json.loads(output)
+
+    def _seed_commands(self, spec: dict, localstack_url: str) -> list[tuple[str, list[str], list[str]]]:
+        """Translate a seed spec into awslocal create and delete commands."""
+        spec = spec or {}
+        commands = []
+
+        for bucket in spec.get("buckets", []):
+            commands.append((
+                f"bucket {bucket}",
+                ["s3api", "create-bucket", "--bucket", bucket],
+                ["s3api", "delete-bucket", "--bucket", bucket],
+            ))
+
+        for queue in spec.get("queues", []):
+            commands.append((
+                f"queue {queue}",
+                ["sqs", "create-queue", "--queue-name", queue],
+                ["sqs", "delete-queue", "--queue-url", f"{localstack_url}/000000000000/{queue}"],
+            ))
+
+        for table in spec.get("tables", []):
+            key_schema = [f"AttributeName={table['hash_key']},KeyType=HASH"]
+            attributes = [f"AttributeName={table['hash_key']},AttributeType={table.get('hash_key_type', 'S')}"]
+            if table.get("range_key"):
+                key_schema.append(f"AttributeName={table['range_key']},KeyType=RANGE")
+                attributes.append(f"AttributeName={table['range_key']},AttributeType={table.get('range_key_type', 'S')}")
+            commands.append((
+                f"table {table['name']}",
+                [
+                    "dynamodb", "create-table",
+                    "--table-name", table["name"],
+                    "--key-schema", *key_schema,
+                    "--attribute-definitions", *attributes,
+                    "--billing-mode", "PAY_PER_REQUEST",
+                ],
+                ["dynamodb", "delete-table", "--table-name", table["name"]],
+            ))
+
+        for parameter in spec.get("parameters", []):
+            commands.append((
+                f"parameter {parameter['name']}",
+                [
+                    "ssm", "put-parameter",
+                    "--name", parameter["name"],
+                    "--value", str(parameter["value"]),
+                    "--type", parameter.get("type", "String"),
+                ],
+                ["ssm", "delete-parameter", "--name", parameter["name"]],
+            ))
+
+        for secret in spec.get("secrets", []):
+            commands.append((
+                f"secret {secret['name']}",
+                ["secretsmanager", "create-secret", "--name", secret["name"], "--secret-string", str(secret["value"])],
+                ["secretsmanager", "delete-secret", "--secret-id", secret["name"], "--force-delete-without-recovery"],
+            ))
+
+        return commands
+
+    async def _run_commands(self, container: dagger.Container, commands: list[list[str]]) -> str:
+        """Run commands in order, raising with the captured output if one of them fails."""
+        output = []
+        for args in commands:
+            container = container.with_exec(args, expect=dagger.ReturnType.ANY)
+            output.append(await container.stdout() + await container.stderr())
+
+            exit_code = await container.exit_code()
+            if exit_code != 0:
+                self._raise_if_not_enabled(output[-1])
+                log = "\n".join(output)
+                raise Exception(f"'{' '.join(args)}' failed with exit code {exit_code}:\n{log}")
+
+        return "\n".join(output)
+
+    def _raise_if_not_enabled(self, output: str) -> None:
+        """Raise a ServiceNotEnabledError if a command failed because its service is not enabled."""
+        match = SERVICE_NOT_ENABLED_PATTERN.search(output)
+        if match:
+            raise ServiceNotEnabledError(
+                f"Service '{match.group(1)}' is not enabled, add it to services to use it"
+            )
+
+    def _image(self, image_name: Optional[str], image_tag: Optional[str], registry: Optional[str]) -> str:
+        """Resolve the reference of the LocalStack image to pull."""
+        image = image_name if image_name else f"{DEFAULT_IMAGE}:{image_tag or 'latest'}"
+
+        # Pull through a registry mirror
+        if registry:
+            registry = registry.rstrip("/")
+            if "://" in registry:
+                raise ValueError(f"Invalid registry '{registry}', pass the host without a scheme")
+
+            # Catch registries that already contain (part of) the image path,
+            # e.g. mirror.example.com/localstack with localstack/localstack
+            namespace = image.split("/")[0]
+            if image.startswith(f"{registry}/") or registry.endswith(f"/{namespace}"):
+                raise ValueError(f"Registry '{registry}' duplicates the image path of '{image}'")
+            image = f"{registry}/{image}"
+
+        return image
+
+    def _client_container(
+        self,
+        localstack_url: str,
+        region: str = DEFAULT_REGION,
+        image: Optional[str] = None,
+        container: Optional[dagger.Container] = None
+    ) -> dagger.Container:
+        """Container from the LocalStack image, set up to talk to a running instance.
+
+        The image defaults to the one configured on the module, and container
+        can carry registry credentials for the pull.
+        """
+        return (
+            (container or dag.container())
+            .from_(image or self._image(self.image_name, None, self.registry))
+            .with_(self._with_aws_env(localstack_url, region))
+        )
+
+    def _with_aws_env(self, localstack_url: str, region: str = DEFAULT_REGION):
+        """Point AWS tooling at LocalStack. The cache buster makes commands run on every call."""
+        def apply(container: dagger.Container) -> dagger.Container:
+            return (
+                container
+                .with_env_variable("AWS_ENDPOINT_URL", localstack_url)
+                .with_env_variable("AWS_ACCESS_KEY_ID", "test")
+                .with_env_variable("AWS_SECRET_ACCESS_KEY", "test")
+                .with_env_variable("AWS_DEFAULT_REGION", region)
+                .with_env_variable("CACHEBUSTER", datetime.now().isoformat())
+            )
+
+        return apply
 
     @function
     async def state(
         self,
-        auth_token: Annotated[Optional[dagger.Secret], Doc("LocalStack Auth Token (required for save/load)")] = None,
+        auth_token: Annotated[Optional[dagger.Secret], Doc("LocalStack Auth Token (required for save/load/delete)")] = None,
         load: Annotated[Optional[str], Doc("Name of the Cloud Pod to load")] = None,
         save: Annotated[Optional[str], Doc("Name of the Cloud Pod to save")] = None,
         endpoint: Annotated[Optional[str], Doc("LocalStack endpoint (defaults to host.docker.internal:4566)")] = None,
-        reset: Annotated[bool, Doc("Reset the LocalStack state")] = False
+        reset: Annotated[bool, Doc("Reset the LocalStack state")] = False,
+        delete: Annotated[Optional[str], Doc("Name of the Cloud Pod to delete")] = None,
+        import_: Annotated[Optional[dagger.File], Doc("Previously exported pod archive to apply to the running instance")] = None,
+        reset_service: Annotated[Optional[str], Doc("Reset the state of a single service (e.g. s3)")] = None,
+        load_many: Annotated[Optional[list[str]], Doc("Names of Cloud Pods to load in order, later pods overlay earlier ones")] = None,
+        version: Annotated[Optional[str], Doc("Version of the Cloud Pod to save or load (defaults to latest for load)")] = None,
+        json_output: Annotated[bool, Doc("Return the result as JSON with operation, success, message, and data fields")] = False,
+        retries: Annotated[int, Doc("Number of retries of Cloud Pod API calls failing with a server error")] = 3,
+        reset_data: Annotated[bool, Doc("Clear the resources of every running service, keeping the instance and its configuration")] = False
     ) -> str:
-        """Load, save, or reset LocalStack state."""
+        """Load, save, reset, import LocalStack state, or delete a Cloud Pod."""
+        if json_output:
+            result = await self.state(
+                auth_token=auth_token,
+                load=load,
+                save=save,
+                endpoint=endpoint,
+                reset=reset,
+                delete=delete,
+                import_=import_,
+                reset_service=reset_service,
+                load_many=load_many,
+                version=version,
+                retries=retries,
+                reset_data=reset_data,
+            )
+            return self._json_result("state", result)
+
+        # Only one operation can be performed at a time
+        if sum(1 for operation in (load, save, reset, delete, import_, reset_service, load_many, reset_data) if operation) > 1:
+            return "Error: Only one of --load, --load-many, --save, --reset, --reset-data, --reset-service, --delete, or --import can be specified."
+
+        # A version only identifies a single pod
+        if version and load_many:
+            return "Error: --version cannot be combined with --load-many, load the pods one by one to pin their versions."
+
+        # Deleting a pod only talks to the platform, no running instance needed
+        if delete:
+            if not auth_token:
+                return "Error: auth_token is required for delete operations."
+
+            headers = {
+                "content-type": "application/json",
+                "ls-api-key": await auth_token.plaintext()
+            }
+            try:
+                pod_response = await self._pod_request("GET", f"{PLATFORM_API_ENDPOINT}/cloudpods/{delete}", retries, headers=headers)
+                pod_response.raise_for_status()
+
+                delete_response = await self._pod_request("DELETE", f"{PLATFORM_API_ENDPOINT}/cloudpods/{delete}", retries, headers=headers)
+                delete_response.raise_for_status()
+
+                return json.dumps(pod_response.json(), indent=2)
+            except requests.RequestException as e:
+                return f"Error: Failed to delete pod '{delete}'. Please check the pod name and your Auth Token.{self._last_response(e)}"
+            except ValueError as e:
+                return f"Error: {str(e)}"
+
         # Base URL for LocalStack API
-        localstack_url = endpoint or "http://host.docker.internal:4566"
+        localstack_url = self._endpoint(endpoint)
         
         # Check if LocalStack is running
         try:
@@ -79,11 +2780,69 @@ class Localstack:
                 return "LocalStack state reset successfully."
             except requests.RequestException as e:
                 return f"Error: Reset failed: {str(e)}"
+
+        # Clear the data of the running services one by one, unlike a full
+        # reset this leaves everything but the service state untouched
+        if reset_data:
+            try:
+                health = await self._get_health(localstack_url)
+            except Exception as e:
+                return f"Error: Reset of the data failed: {str(e)}"
+
+            cleared = []
+            for service_name, status in health.get("services", {}).items():
+                if status != "running":
+                    continue
+                try:
+                    reset_response = requests.post(f"{localstack_url}/_localstack/state/{service_name}/reset")
+                    if reset_response.status_code == 404:
+                        continue
+                    reset_response.raise_for_status()
+                    cleared.append(service_name)
+                except requests.RequestException as e:
+                    return f"Error: Reset of the data of service '{service_name}' failed: {str(e)}"
+
+            if not cleared:
+                return "No running services with data to clear."
+            return f"Cleared the data of services: {', '.join(cleared)}. Configuration and the instance were kept."
+
+        # Handle reset of a single service
+        if reset_service:
+            try:
+                reset_response = requests.post(f"{localstack_url}/_localstack/state/{reset_service}/reset")
+                if reset_response.status_code == 404:
+                    return f"Error: Service '{reset_service}' does not support a scoped reset."
+                reset_response.raise_for_status()
+                return f"LocalStack state of service '{reset_service}' reset successfully."
+            except requests.RequestException as e:
+                return f"Error: Reset of service '{reset_service}' failed: {str(e)}"
+
+        # Handle import operation, which works without the Cloud Pods registry
+        if import_:
+            archive = await self._read_binary(import_)
+
+            try:
+                with zipfile.ZipFile(io.BytesIO(archive)) as pod:
+                    if not pod.namelist():
+                        return "Error: The pod archive is empty."
+            except zipfile.BadZipFile:
+                return "Error: The file is not a valid pod archive."
+
+            try:
+                import_response = requests.post(
+                    f"{localstack_url}/_localstack/pods",
+                    headers={"Content-Type": "application/octet-stream"},
+                    data=archive
+                )
+                import_response.raise_for_status()
+                return "LocalStack state imported successfully."
+            except requests.RequestException as e:
+                return f"Error: Import failed: {str(e)}"
             
-        if (save or load) and not auth_token:
+        if (save or load or load_many) and not auth_token:
             return "Error: auth_token is required for save and load operations."
             
-        if (save or load) and auth_token:
+        if (save or load or load_many) and auth_token:
             # Use a separate container to calculate state secret to avoid exposing token
             state_secret_container = (
                 dag.container()
@@ -99,49 +2858,460 @@ class Localstack:
                 "x-localstack-state-secret": state_secret.strip()
             }
             
+            # Pin the pod version if one was requested
+            pod_options = {"version": version} if version else {}
+
             # Execute the pod operation based on the provided parameters
             if save:
                 try:
-                    save_response = requests.post(
+                    save_response = await self._pod_request(
+                        "POST",
                         f"{localstack_url}/_localstack/pods/{save}",
+                        retries,
                         headers=headers,
-                        json={}
+                        json=pod_options
                     )
                     save_response.raise_for_status()
-                    return save_response.text
-                except requests.RequestException:
-                    return f"Error: Failed to save pod '{save}'. Please check the pod name and your Auth Token."
+                    return f"{save_response.text}\nVersion: {self._pod_version(save_response, version)}"
+                except requests.RequestException as e:
+                    return f"Error: Failed to save pod '{save}'. Please check the pod name and your Auth Token.{self._last_response(e)}"
+                except ValueError as e:
+                    return f"Error: {str(e)}"
             elif load:
                 try:
-                    load_response = requests.put(
+                    load_response = await self._pod_request(
+                        "PUT",
                         f"{localstack_url}/_localstack/pods/{load}",
+                        retries,
                         headers=headers,
-                        json={}
+                        json=pod_options
                     )
                     load_response.raise_for_status()
-                    return load_response.text
-                except requests.RequestException:
-                    return f"Error: Failed to load pod '{load}'. Please check the pod name and your Auth Token."
+                    return f"{load_response.text}\nVersion: {self._pod_version(load_response, version)}"
+                except requests.RequestException as e:
+                    return f"Error: Failed to load pod '{load}'. Please check the pod name and your Auth Token.{self._last_response(e)}"
+                except ValueError as e:
+                    return f"Error: {str(e)}"
+            elif load_many:
+                # Load the pods one after another so later pods overlay earlier ones
+                summary = []
+                for pod in load_many:
+                    try:
+                        load_response = await self._pod_request(
+                            "PUT",
+                            f"{localstack_url}/_localstack/pods/{pod}",
+                            retries,
+                            headers=headers,
+                            json={}
+                        )
+                        load_response.raise_for_status()
+                        summary.append(f"{pod}: {load_response.text}")
+                    except requests.RequestException as e:
+                        summary.append(f"Error: Failed to load pod '{pod}'. Please check the pod name and your Auth Token.{self._last_response(e)}")
+                        return "\n".join(summary)
+                    except ValueError as e:
+                        return f"Error: {str(e)}"
+
+                return "\n".join(summary)
             
-        return "No operation specified. Please provide either --load, --save, or --reset parameter."
+        return "No operation specified. Please provide either --load, --load-many, --save, --reset, --reset-data, --reset-service, --delete, or --import parameter."
+
+    async def _pod_request(self, method: str, url: str, retries: int, **kwargs) -> requests.Response:
+        """Send a Cloud Pods API request, retrying with backoff on connection and server errors."""
+        if retries < 0:
+            raise ValueError(f"retries must be 0 or more, got {retries}")
+
+        delay = 1
+        for attempt in range(retries + 1):
+            try:
+                response = requests.request(method, url, **kwargs)
+                if response.status_code < 500 or attempt == retries:
+                    return response
+            except requests.ConnectionError:
+                if attempt == retries:
+                    raise
+            await asyncio.sleep(delay)
+            delay = min(delay * 2, READINESS_MAX_BACKOFF)
+
+    def _last_response(self, error: requests.RequestException) -> str:
+        """Describe the response of a failed request, if there was one."""
+        if error.response is None or not error.response.text:
+            return ""
+        return f" Last response: {error.response.text}"
+
+    def _json_result(self, operation: str, result: str) -> str:
+        """Wrap a string result in a stable JSON schema for machine consumption."""
+        try:
+            data = json.loads(result)
+        except ValueError:
+            data = None
+
+        return json.dumps({
+            "operation": operation,
+            "success": not result.startswith("Error"),
+            "message": result if data is None else "",
+            "data": data,
+        }, indent=2)
+
+    async def _read_binary(self, file: dagger.File) -> bytes:
+        """Read a binary file through a container, as file contents are returned as text."""
+        encoded = await (
+            dag.container()
+            .from_("python:3.9-slim")
+            .with_mounted_file("/data", file)
+            .with_exec(["base64", "-w0", "/data"])
+            .stdout()
+        )
+        return base64.b64decode(encoded.strip())
+
+    def _pod_version(self, response: requests.Response, requested: Optional[str]) -> str:
+        """Resolve the pod version from a pod API response, falling back to the requested one."""
+        try:
+            resolved = response.json().get("version")
+        except (ValueError, AttributeError):
+            resolved = None
+        return str(resolved or requested or "latest")
 
     @function
-    async def ephemeral(
+    async def list_pods(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")]
+    ) -> list[PodInfo]:
+        """List the Cloud Pods saved for the account."""
+        headers = {
+            "content-type": "application/json",
+            "ls-api-key": await auth_token.plaintext()
+        }
+
+        # Fetch all pages of the pod listing. Stop once a page has no pods we
+        # haven't seen, in case the API ignores limit and offset and keeps
+        # returning the same pods.
+        pods = {}
+        page_size = 100
+        for _ in range(LIST_PODS_MAX_PAGES):
+            try:
+                response = requests.get(
+                    f"{PLATFORM_API_ENDPOINT}/cloudpods",
+                    headers=headers,
+                    params={"limit": page_size, "offset": len(pods)}
+                )
+                response.raise_for_status()
+                page = response.json()
+            except requests.RequestException as e:
+                raise Exception(f"Failed to list Cloud Pods: {str(e)}")
+
+            if isinstance(page, dict):
+                page = page.get("cloudpods", [])
+
+            new = [pod for pod in page if pod.get("pod_name", "") not in pods]
+            for pod in new:
+                pods[pod.get("pod_name", "")] = pod
+            if not new or len(page) < page_size:
+                break
+
+        result = []
+        for pod in pods.values():
+            versions = pod.get("versions") or [{}]
+            latest = versions[-1]
+            result.append(PodInfo(
+                name=pod.get("pod_name", ""),
+                size=int(latest.get("storage_size") or 0),
+                last_modified=datetime.fromtimestamp(pod["last_change"]).isoformat() if pod.get("last_change") else "",
+            ))
+
+        return result
+
+    @function
+    async def export_pod(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
+        name: Annotated[str, Doc("Name of the Cloud Pod to export")]
+    ) -> dagger.File:
+        """Export a Cloud Pod as an archive file."""
+        headers = {
+            "content-type": "application/json",
+            "ls-api-key": await auth_token.plaintext()
+        }
+
+        # The platform hands out a short-lived download URL for the pod archive
+        try:
+            response = requests.get(f"{PLATFORM_API_ENDPOINT}/cloudpods/{name}/data", headers=headers)
+            if response.status_code == 404:
+                raise PodNotFoundError(f"Cloud Pod '{name}' does not exist")
+            response.raise_for_status()
+            download_url = response.json()["url"]
+        except (requests.RequestException, KeyError, ValueError):
+            raise Exception(f"Failed to export pod '{name}'. Please check the pod name and your Auth Token.")
+
+        return dag.http(download_url)
+
+    @function
+    async def create_pod(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
+        name: Annotated[str, Doc("Name of the Cloud Pod to create")],
+        spec: Annotated[dagger.File, Doc("YAML file describing the resources of the pod, as used by seed")]
+    ) -> PodInfo:
+        """Create a Cloud Pod from a declarative resource spec using a throwaway LocalStack instance."""
+        service = await self.start(auth_token=auth_token, startup_timeout=DEFAULT_STARTUP_TIMEOUT)
+        try:
+            endpoint = await service.endpoint(scheme="http")
+            await self.seed(spec=spec, endpoint=endpoint)
+            result = await self.state(auth_token=auth_token, save=name, endpoint=endpoint)
+            if result.startswith("Error"):
+                raise Exception(result)
+        finally:
+            await service.stop()
+
+        for pod in await self.list_pods(auth_token):
+            if pod.name == name:
+                return pod
+        return PodInfo(name=name, size=0, last_modified=datetime.now().isoformat())
+
+    @function
+    async def clone_pod(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
+        source: Annotated[str, Doc("Name of the Cloud Pod to copy")],
+        dest: Annotated[str, Doc("Name of the new Cloud Pod")],
+        overwrite: Annotated[bool, Doc("Replace the destination pod if it already exists")] = False
+    ) -> PodInfo:
+        """Copy a Cloud Pod under a new name using a throwaway LocalStack instance."""
+        pods = {pod.name: pod for pod in await self.list_pods(auth_token)}
+        if source not in pods:
+            raise PodNotFoundError(f"Cloud Pod '{source}' does not exist")
+        if dest in pods and not overwrite:
+            raise Exception(f"Cloud Pod '{dest}' already exists, set overwrite to replace it")
+
+        service = await self.start(auth_token=auth_token, startup_timeout=DEFAULT_STARTUP_TIMEOUT)
+        try:
+            endpoint = await service.endpoint(scheme="http")
+            for operation in ({"load": source}, {"save": dest}):
+                result = await self.state(auth_token=auth_token, endpoint=endpoint, **operation)
+                if result.startswith("Error"):
+                    raise Exception(result)
+        finally:
+            await service.stop()
+
+        for pod in await self.list_pods(auth_token):
+            if pod.name == dest:
+                return pod
+        return PodInfo(name=dest, size=pods[source].size, last_modified=datetime.now().isoformat())
+
+    @function
+    async def create_ephemeral(
         self,
         auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
-        operation: Annotated[str, Doc("Operation to perform (create, list, delete, logs)")],
-        name: Annotated[Optional[str], Doc("Name of the ephemeral instance (required for create, delete, logs)")] = None,
+        name: Annotated[str, Doc("Name of the ephemeral instance")],
         lifetime: Annotated[Optional[int], Doc("Lifetime of the instance in minutes (default: 60)")] = None,
         auto_load_pod: Annotated[Optional[str], Doc("Auto load pod configuration")] = None,
-        extension_auto_install: Annotated[Optional[str], Doc("Extension auto install configuration")] = None
+        extension_auto_install: Annotated[Optional[str], Doc("Extension auto install configuration")] = None,
+        auto_stop_idle_minutes: Annotated[Optional[int], Doc("Stop the instance after this many minutes without requests, if supported by the platform")] = None
+    ) -> EphemeralInstance:
+        """Create an ephemeral LocalStack instance and return its endpoint, ID, and expiry."""
+        response = await self.ephemeral(
+            auth_token=auth_token,
+            operation="create",
+            name=name,
+            lifetime=lifetime,
+            auto_load_pod=auto_load_pod,
+            extension_auto_install=extension_auto_install,
+            auto_stop_idle_minutes=auto_stop_idle_minutes,
+        )
+        if response.startswith("Error"):
+            raise Exception(response)
+
+        return self._ephemeral_instance(json.loads(response))
+
+    @function
+    async def ephemeral_endpoint(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
+        name: Annotated[str, Doc("Name of the ephemeral instance")]
+    ) -> str:
+        """Get the endpoint URL of a running ephemeral LocalStack instance."""
+        headers = {
+            "content-type": "application/json",
+            "ls-api-key": await auth_token.plaintext()
+        }
+
+        try:
+            response = requests.get(f"{PLATFORM_API_ENDPOINT}/compute/instances", headers=headers)
+            response.raise_for_status()
+            instances = response.json()
+        except requests.RequestException as e:
+            raise Exception(f"Failed to list ephemeral instances: {str(e)}")
+
+        for instance in instances:
+            if instance.get("instance_name") == name:
+                return self._ephemeral_instance(instance).endpoint
+
+        raise Exception(f"Ephemeral instance '{name}' not found")
+
+    @function
+    async def prune_ephemeral(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
+        older_than_minutes: Annotated[int, Doc("Delete instances created more than this many minutes ago")] = 60,
+        dry_run: Annotated[bool, Doc("Only return the instances that would be deleted")] = False
+    ) -> list[str]:
+        """Delete the ephemeral LocalStack instances of the account older than a threshold and return their names."""
+        headers = {
+            "content-type": "application/json",
+            "ls-api-key": await auth_token.plaintext()
+        }
+
+        try:
+            response = requests.get(f"{PLATFORM_API_ENDPOINT}/compute/instances", headers=headers)
+            response.raise_for_status()
+            instances = response.json()
+        except requests.RequestException as e:
+            raise Exception(f"Failed to list ephemeral instances: {str(e)}")
+
+        stale = []
+        for instance in instances:
+            if not instance.get("creation_time"):
+                continue
+            created = datetime.fromisoformat(instance["creation_time"].replace("Z", "+00:00"))
+            age = datetime.now(created.tzinfo) - created
+            if age.total_seconds() > older_than_minutes * 60:
+                stale.append(instance.get("instance_name", ""))
+
+        if dry_run:
+            return stale
+
+        deleted = []
+        for name in stale:
+            try:
+                requests.delete(f"{PLATFORM_API_ENDPOINT}/compute/instances/{name}", headers=headers).raise_for_status()
+                deleted.append(name)
+            except requests.RequestException as e:
+                print(f"Warning: Failed to delete ephemeral instance '{name}': {str(e)}")
+
+        return deleted
+
+    def _ephemeral_instance(self, instance: dict) -> EphemeralInstance:
+        """Convert an instance returned by the platform API."""
+        return EphemeralInstance(
+            name=instance.get("instance_name", ""),
+            id=instance.get("id", ""),
+            endpoint=instance.get("endpoint_url", ""),
+            expiry_time=instance.get("expiry_time", ""),
+            idle_timeout=int(instance.get("idle_timeout") or 0),
+        )
+
+    @function
+    async def verify_pod(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
+        name: Annotated[str, Doc("Name of the Cloud Pod to verify")]
+    ) -> PodInventory:
+        """Check that a Cloud Pod is complete and readable without loading it, and return its contents."""
+        pods = {pod.name: pod for pod in await self.list_pods(auth_token)}
+        if name not in pods:
+            raise PodNotFoundError(f"Cloud Pod '{name}' does not exist")
+
+        archive = await self._read_binary(await self.export_pod(auth_token=auth_token, name=name))
+
+        problems = []
+        if pods[name].size and len(archive) != pods[name].size:
+            problems.append(f"archive is {len(archive)} bytes but the pod metadata reports {pods[name].size} bytes")
+
+        files = []
+        try:
+            with zipfile.ZipFile(io.BytesIO(archive)) as pod:
+                files = sorted(info.filename for info in pod.infolist() if not info.is_dir())
+                damaged = pod.testzip()
+                if damaged:
+                    problems.append(f"checksum mismatch in '{damaged}'")
+        except (zipfile.BadZipFile, zlib.error, EOFError) as e:
+            problems.append(f"archive is not a readable zip file ({str(e)})")
+
+        if not files and not problems:
+            problems.append("archive contains no state files")
+        if problems:
+            raise PodCorruptedError(f"Cloud Pod '{name}' is corrupted: " + "; ".join(problems))
+
+        services = {next((part for part in path.split("/") if part in KNOWN_SERVICES), "other") for path in files}
+        return PodInventory(name=name, size=len(archive), services=sorted(services), files=files)
+
+    @function
+    async def diff_pods(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
+        pod_a: Annotated[str, Doc("Name of the first Cloud Pod")],
+        pod_b: Annotated[str, Doc("Name of the second Cloud Pod")]
+    ) -> str:
+        """Compare the contents of two Cloud Pods, grouped by service."""
+        contents = []
+        for name in (pod_a, pod_b):
+            archive = await self._read_binary(await self.export_pod(auth_token=auth_token, name=name))
+            with zipfile.ZipFile(io.BytesIO(archive)) as pod:
+                contents.append({
+                    info.filename: info.CRC
+                    for info in pod.infolist()
+                    if not info.is_dir()
+                })
+        files_a, files_b = contents
+
+        # Group the differences by the service the state file belongs to
+        changes = {}
+        for path in sorted(set(files_a) | set(files_b)):
+            if path not in files_b:
+                change = f"- {path}"
+            elif path not in files_a:
+                change = f"+ {path}"
+            elif files_a[path] != files_b[path]:
+                change = f"~ {path}"
+            else:
+                continue
+
+            service = next((part for part in path.split("/") if part in KNOWN_SERVICES), "other")
+            changes.setdefault(service, []).append(change)
+
+        if not changes:
+            return f"No differences between '{pod_a}' and '{pod_b}'."
+
+        output = [f"--- {pod_a}", f"+++ {pod_b}"]
+        for service in sorted(changes):
+            output.append(f"[{service}]")
+            output.extend(changes[service])
+
+        return "\n".join(output)
+
+    @function
+    async def ephemeral(
+        self,
+        auth_token: Annotated[dagger.Secret, Doc("LocalStack Auth Token (required)")],
+        operation: Annotated[str, Doc("Operation to perform (create, list, delete, logs, extend, wait)")],
+        name: Annotated[Optional[str], Doc("Name of the ephemeral instance (required for create, delete, logs, extend, wait)")] = None,
+        lifetime: Annotated[Optional[int], Doc("Lifetime of the instance in minutes (default: 60), or minutes to add for extend")] = None,
+        auto_load_pod: Annotated[Optional[str], Doc("Auto load pod configuration")] = None,
+        extension_auto_install: Annotated[Optional[str], Doc("Extension auto install configuration")] = None,
+        timeout: Annotated[Optional[int], Doc("Seconds to wait for the instance to be running (default: 300, only for wait)")] = None,
+        json_output: Annotated[bool, Doc("Return the result as JSON with operation, success, message, and data fields")] = False,
+        auto_stop_idle_minutes: Annotated[Optional[int], Doc("Stop the instance after this many minutes without requests, if supported by the platform (only for create)")] = None
     ) -> str:
         """Manage ephemeral LocalStack instances in the cloud."""
+        if json_output:
+            result = await self.ephemeral(
+                auth_token=auth_token,
+                operation=operation,
+                name=name,
+                lifetime=lifetime,
+                auto_load_pod=auto_load_pod,
+                extension_auto_install=extension_auto_install,
+                timeout=timeout,
+                auto_stop_idle_minutes=auto_stop_idle_minutes,
+            )
+            return self._json_result(f"ephemeral.{operation}", result)
+
         if not auth_token:
             return "Error: auth_token is required for ephemeral instance operations"
 
         # Base API endpoint
-        api_endpoint = "https://api.localstack.cloud/v1"
-        
+        api_endpoint = PLATFORM_API_ENDPOINT
+
         # Get Auth Token value from secret
         auth_token_value = await auth_token.plaintext()
         
@@ -181,6 +3351,8 @@ class Localstack:
                 "instance_name": name,
                 "lifetime": lifetime or 60,
             }
+            if auto_stop_idle_minutes:
+                data["idle_timeout"] = auto_stop_idle_minutes
             
             # Only add env_vars if either auto_load_pod or extension_auto_install is provided
             if auto_load_pod or extension_auto_install:
@@ -249,5 +3421,67 @@ class Localstack:
             except Exception as e:
                 return f"Error: Failed to fetch logs for instance '{name}': {str(e)}"
 
+        elif operation == "extend":
+            if not name:
+                return "Error: name is required for extend operation"
+            if not lifetime:
+                return "Error: lifetime is required for extend operation"
+
+            try:
+                instance_response = requests.get(
+                    f"{api_endpoint}/compute/instances/{name}",
+                    headers=headers
+                )
+                if instance_response.status_code == 404:
+                    return f"Error: Instance '{name}' does not exist or has already expired"
+                instance_response.raise_for_status()
+
+                instance = instance_response.json()
+                expiry_time = datetime.fromisoformat(instance["expiry_time"].replace("Z", "+00:00"))
+                now = datetime.now(expiry_time.tzinfo)
+                if expiry_time <= now:
+                    return f"Error: Instance '{name}' has already expired"
+
+                # The lifetime counts from the creation of the instance, so the
+                # extension is added to its current total lifetime
+                current = instance.get("lifetime")
+                if current is None:
+                    creation_time = datetime.fromisoformat(instance["creation_time"].replace("Z", "+00:00"))
+                    current = round((expiry_time - creation_time).total_seconds() / 60)
+                response = requests.patch(
+                    f"{api_endpoint}/compute/instances/{name}",
+                    headers=headers,
+                    json={"lifetime": int(current) + lifetime}
+                )
+                response.raise_for_status()
+
+                return f"Instance '{name}' now expires at {response.json().get('expiry_time')}"
+            except Exception as e:
+                return f"Error: Failed to extend ephemeral instance '{name}': {str(e)}"
+
+        elif operation == "wait":
+            if not name:
+                return "Error: name is required for wait operation"
+
+            deadline = time.monotonic() + (timeout or 300)
+            status = "unknown"
+            while time.monotonic() < deadline:
+                try:
+                    response = requests.get(
+                        f"{api_endpoint}/compute/instances/{name}",
+                        headers=headers
+                    )
+                    if response.ok:
+                        instance = response.json()
+                        status = instance.get("status", "unknown")
+                        if status == "running":
+                            return instance.get("endpoint_url", "")
+                except Exception:
+                    pass
+
+                await asyncio.sleep(5)
+
+            return f"Error: Instance '{name}' was not running after {timeout or 300} seconds (status: {status})"
+
         else:
-            return "Error: Invalid operation. Supported operations are: create, list, delete, logs"
+            return "Error: Invalid operation. Supported operations are: create, list, delete, logs, extend, wait"
@@ -17,6 +17,27 @@ class Tests:
         await self.test_localstack_pro(auth_token=auth_token)
         await self.test_state_operations(auth_token=auth_token)
         await self.test_ephemeral_operations(auth_token=auth_token)
+        await self.test_stop(auth_token=auth_token)
+        await self.test_logs(auth_token=auth_token)
+        await self.test_health(auth_token=auth_token)
+        await self.test_wait_for_services(auth_token=auth_token)
+        await self.test_endpoints(auth_token=auth_token)
+        await self.test_restart(auth_token=auth_token)
+        await self.test_exec(auth_token=auth_token)
+        await self.test_awslocal(auth_token=auth_token)
+        await self.test_reset_service(auth_token=auth_token)
+        await self.test_inspect(auth_token=auth_token)
+        await self.test_seed(auth_token=auth_token)
+        await self.test_service_binding(auth_token=auth_token)
+        await self.test_gateway_port(auth_token=auth_token)
+        await self.test_deploy_cloud_formation(auth_token=auth_token)
+        await self.test_events(auth_token=auth_token)
+        await self.test_create_pod(auth_token=auth_token)
+        await self.test_snapshot_restore(auth_token=auth_token)
+        await self.test_send_sqs_message(auth_token=auth_token)
+        await self.test_services(auth_token=auth_token)
+        await self.test_create_execution_role(auth_token=auth_token)
+        await self.test_attach(auth_token=auth_token)
 
     @function
     async def test_localstack_health(self, auth_token: dagger.Secret) -> str:
@@ -74,7 +95,7 @@ class Tests:
 
     @function
     async def test_state_operations(self, auth_token: dagger.Secret) -> str:
-        """Test LocalStack state operations (save/load/reset) with AWS resources"""
+        """Test LocalStack state operations (save/load/reset/delete) with AWS resources"""
         # Start LocalStack
         service = dag.localstack().start(auth_token=auth_token)
         await service.start()
@@ -109,6 +130,11 @@ class Tests:
                 endpoint=f"http://{endpoint}"
             )
 
+            # Verify the pod was saved
+            pod_names = [await pod.name() for pod in await state_module.list_pods(auth_token=auth_token)]
+            if "test-dagger-pod" not in pod_names:
+                raise Exception("State save failed: pod not found in pod listing")
+
             # Reset state
             await state_module.state(reset=True, endpoint=f"http://{endpoint}")
 
@@ -142,6 +168,14 @@ class Tests:
             if content != "Hello LocalStack":
                 raise Exception(f"State load failed: object content mismatch. Expected 'Hello LocalStack', got '{content}'")
 
+            # Delete the pod again
+            delete_response = await state_module.state(
+                auth_token=auth_token,
+                delete="test-dagger-pod"
+            )
+            if delete_response.startswith("Error"):
+                raise Exception(f"State delete failed: {delete_response}")
+
             return "Success: State save/load/reset operations working correctly"
 
         except Exception as e:
@@ -164,7 +198,13 @@ class Tests:
             )
 
             # Wait for instance to be ready
-            time.sleep(15)
+            endpoint_url = await ephemeral_module.ephemeral(
+                auth_token=auth_token,
+                operation="wait",
+                name=instance_name
+            )
+            if endpoint_url.startswith("Error"):
+                raise Exception(endpoint_url)
             
             # Parse and verify create response
             create_data = json.loads(create_response)
@@ -186,6 +226,10 @@ class Tests:
                     
             if not instance_found:
                 raise Exception(f"Created instance {instance_name} not found in list response")
+
+            # Look up the endpoint by name
+            if await ephemeral_module.ephemeral_endpoint(auth_token=auth_token, name=instance_name) != endpoint_url:
+                raise Exception("Endpoint lookup returned a different endpoint than wait")
             
             # Get instance logs and verify they contain version information
             logs_response = await ephemeral_module.ephemeral(
@@ -221,3 +265,434 @@ class Tests:
                 )
             except:
                 pass
+
+    @function
+    async def test_stop(self, auth_token: dagger.Secret) -> str:
+        """Test if a started LocalStack service can be stopped"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+
+        result = dag.localstack().stop(service=service)
+        if not await result.graceful():
+            raise Exception(f"Test failed: LocalStack was killed instead of stopping gracefully: {await result.output()}")
+
+        return "Success: LocalStack stopped gracefully"
+
+    @function
+    async def test_logs(self, auth_token: dagger.Secret) -> str:
+        """Test if LocalStack logs can be retrieved"""
+        service = dag.localstack().start(auth_token=auth_token, startup_timeout=120)
+        await service.start()
+
+        logs = await dag.localstack().logs(service=service, tail=50)
+        if "Ready." not in logs:
+            raise Exception(f"Test failed: LocalStack logs do not contain the ready marker: {logs}")
+
+        return "Success: LocalStack logs retrieved"
+
+    @function
+    async def test_health(self, auth_token: dagger.Secret) -> str:
+        """Test if the health function reports the running services"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint()
+
+        health = dag.localstack().health(endpoint=f"http://{endpoint}")
+        if not await health.version():
+            raise Exception("Test failed: health is missing the version")
+
+        statuses = {}
+        for service_status in await health.services():
+            statuses[await service_status.name()] = await service_status.status()
+
+        if statuses.get("s3") not in ("running", "available"):
+            raise Exception(f"Test failed: unexpected S3 status: {statuses.get('s3')}")
+
+        return "Success: LocalStack health reported"
+
+    @function
+    async def test_wait_for_services(self, auth_token: dagger.Secret) -> str:
+        """Test if waiting for services succeeds once they are ready"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint()
+
+        result = await dag.localstack().wait_for_services(
+            services=["s3", "sqs"],
+            endpoint=f"http://{endpoint}"
+        )
+        if not result.startswith("Services ready"):
+            raise Exception(f"Test failed: unexpected response: {result}")
+
+        return "Success: LocalStack services are ready"
+
+    @function
+    async def test_endpoints(self, auth_token: dagger.Secret) -> str:
+        """Test if every service maps to the gateway endpoint"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint()
+
+        urls = {}
+        for service_endpoint in await dag.localstack().endpoints(endpoint=f"http://{endpoint}"):
+            urls[await service_endpoint.name()] = await service_endpoint.url()
+
+        if urls.get("s3") != f"http://{endpoint}":
+            raise Exception(f"Test failed: unexpected S3 endpoint: {urls.get('s3')}")
+
+        return "Success: LocalStack endpoints listed"
+
+    @function
+    async def test_restart(self, auth_token: dagger.Secret) -> str:
+        """Test if a restarted LocalStack keeps its endpoint and persisted state"""
+        service = dag.localstack().start(auth_token=auth_token, persist=dag.directory())
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        s3 = boto3.client(
+            's3',
+            endpoint_url=endpoint,
+            aws_access_key_id='test',
+            aws_secret_access_key='test',
+            region_name='us-east-1'
+        )
+        s3.create_bucket(Bucket='test-restart-bucket')
+
+        restarted_endpoint = await dag.localstack().restart(service=service)
+        if restarted_endpoint != endpoint:
+            raise Exception(f"Test failed: endpoint changed from {endpoint} to {restarted_endpoint}")
+
+        try:
+            s3.head_bucket(Bucket='test-restart-bucket')
+        except s3.exceptions.ClientError:
+            raise Exception("Test failed: bucket did not survive the restart")
+
+        await dag.localstack().restart(service=service, clear_persistence=True)
+        return "Success: LocalStack restarted with persisted state"
+
+    @function
+    async def test_exec(self, auth_token: dagger.Secret) -> str:
+        """Test if commands can be run against LocalStack"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        result = dag.localstack().exec(
+            args=["curl", "-s", f"{endpoint}/_localstack/info"],
+            endpoint=endpoint
+        )
+        if await result.exit_code() != 0:
+            raise Exception(f"Test failed: command exited with {await result.exit_code()}")
+        if "version" not in await result.output():
+            raise Exception("Test failed: command output is missing the version")
+
+        # The logs of the instance are mounted when its service is passed
+        result = dag.localstack().exec(args=["ls", "/var/lib/localstack/logs"], service=service)
+        if "localstack_infra.log" not in await result.output():
+            raise Exception(f"Test failed: logs of the instance are not mounted: {await result.output()}")
+
+        return "Success: Command run against LocalStack"
+
+    @function
+    async def test_awslocal(self, auth_token: dagger.Secret) -> str:
+        """Test if awslocal commands run against LocalStack"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        await dag.localstack().awslocal(args=["s3", "mb", "s3://test-awslocal-bucket"], endpoint=endpoint)
+        output = await dag.localstack().awslocal(args=["s3", "ls"], endpoint=endpoint)
+        if "test-awslocal-bucket" not in output:
+            raise Exception(f"Test failed: bucket not listed: {output}")
+
+        return "Success: awslocal commands working correctly"
+
+    @function
+    async def test_reset_service(self, auth_token: dagger.Secret) -> str:
+        """Test if resetting a single service keeps the state of other services"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        session = boto3.Session(
+            aws_access_key_id='test',
+            aws_secret_access_key='test',
+            region_name='us-east-1'
+        )
+        s3 = session.client('s3', endpoint_url=endpoint)
+        sqs = session.client('sqs', endpoint_url=endpoint)
+
+        s3.create_bucket(Bucket='test-reset-bucket')
+        sqs.create_queue(QueueName='test-reset-queue')
+
+        result = await dag.localstack().state(reset_service="s3", endpoint=endpoint)
+        if result.startswith("Error"):
+            raise Exception(f"Test failed: {result}")
+
+        if s3.list_buckets()["Buckets"]:
+            raise Exception("Test failed: S3 state was not reset")
+        if not sqs.list_queues().get("QueueUrls"):
+            raise Exception("Test failed: SQS state was reset as well")
+
+        return "Success: Single service state reset"
+
+    @function
+    async def test_inspect(self, auth_token: dagger.Secret) -> str:
+        """Test if inspect reports the instance metadata"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        info = dag.localstack().inspect(endpoint=endpoint, service=service)
+        if await info.edition() != "pro":
+            raise Exception(f"Test failed: unexpected edition: {await info.edition()}")
+        if "s3" not in await info.services():
+            raise Exception("Test failed: S3 is not listed as enabled")
+        if await info.image() != "localstack/localstack:latest":
+            raise Exception(f"Test failed: unexpected image: {await info.image()}")
+        if 4566 not in await info.ports():
+            raise Exception("Test failed: gateway port is not listed")
+        if not (await info.name()).startswith("localstack-"):
+            raise Exception(f"Test failed: unexpected instance name: {await info.name()}")
+
+        return "Success: LocalStack instance inspected"
+
+    @function
+    async def test_seed(self, auth_token: dagger.Secret) -> str:
+        """Test if resources are created from a seed spec"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        spec = dag.directory().with_new_file(
+            "seed.yaml",
+            "buckets:\n  - test-seed-bucket\nqueues:\n  - test-seed-queue\n"
+        ).file("seed.yaml")
+        await dag.localstack().seed(spec=spec, endpoint=endpoint)
+
+        s3 = boto3.client(
+            's3',
+            endpoint_url=endpoint,
+            aws_access_key_id='test',
+            aws_secret_access_key='test',
+            region_name='us-east-1'
+        )
+        s3.head_bucket(Bucket='test-seed-bucket')
+
+        return "Success: Resources seeded"
+
+    @function
+    async def test_service_binding(self, auth_token: dagger.Secret) -> str:
+        """Test if LocalStack can be bound to another container"""
+        service = dag.localstack().start(auth_token=auth_token)
+
+        output = await (
+            dag.container()
+            .from_("curlimages/curl")
+            .with_service_binding("localstack", service)
+            .with_exec(["curl", "-sf", "http://localstack:4566/_localstack/info"])
+            .stdout()
+        )
+        if "version" not in output:
+            raise Exception(f"Test failed: unexpected response from bound service: {output}")
+
+        return "Success: LocalStack reachable through a service binding"
+
+    @function
+    async def test_gateway_port(self, auth_token: dagger.Secret) -> str:
+        """Test if LocalStack serves on a custom gateway port"""
+        service = dag.localstack().start(auth_token=auth_token, gateway_port=4567)
+        await service.start()
+        endpoint = await service.endpoint()
+
+        if not endpoint.endswith(":4567"):
+            raise Exception(f"Test failed: endpoint does not use the gateway port: {endpoint}")
+
+        response = requests.get(f"http://{endpoint}/_localstack/info")
+        response.raise_for_status()
+
+        return "Success: LocalStack serves on the custom gateway port"
+
+    @function
+    async def test_deploy_cloud_formation(self, auth_token: dagger.Secret) -> str:
+        """Test if a CloudFormation template is deployed and its outputs returned"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        template = dag.directory().with_new_file(
+            "template.yaml",
+            "Resources:\n"
+            "  Bucket:\n"
+            "    Type: AWS::S3::Bucket\n"
+            "    Properties:\n"
+            "      BucketName: test-cfn-bucket\n"
+            "Outputs:\n"
+            "  BucketName:\n"
+            "    Value: !Ref Bucket\n"
+        ).file("template.yaml")
+
+        outputs = {}
+        for output in await dag.localstack().deploy_cloud_formation(
+            template=template,
+            stack_name="test-cfn-stack",
+            endpoint=endpoint
+        ):
+            outputs[await output.key()] = await output.value()
+
+        if outputs.get("BucketName") != "test-cfn-bucket":
+            raise Exception(f"Test failed: unexpected stack outputs: {outputs}")
+
+        stack_outputs = await dag.localstack().stack_outputs(stack_name="test-cfn-stack", endpoint=endpoint)
+        if len(stack_outputs) != len(outputs):
+            raise Exception("Test failed: stack outputs differ from the deploy outputs")
+
+        return "Success: CloudFormation template deployed"
+
+    @function
+    async def test_events(self, auth_token: dagger.Secret) -> str:
+        """Test if API calls are reported as events"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        await dag.localstack().awslocal(args=["s3", "mb", "s3://test-events-bucket"], endpoint=endpoint)
+        events = await dag.localstack().events(localstack=service, service="s3", count=1, timeout=30)
+        if not events:
+            raise Exception("Test failed: no events reported")
+        if await events[0].service() != "s3":
+            raise Exception(f"Test failed: unexpected event service {await events[0].service()}")
+
+        return "Success: API calls reported as events"
+
+    @function
+    async def test_create_pod(self, auth_token: dagger.Secret) -> str:
+        """Test if a Cloud Pod can be created from a resource spec"""
+        pod_name = f"test-dagger-create-pod-{uuid.uuid4().hex[:8]}"
+        spec = dag.directory().with_new_file(
+            "seed.yaml",
+            "buckets:\n  - test-create-pod-bucket\n",
+        ).file("seed.yaml")
+
+        pod = await dag.localstack().create_pod(auth_token=auth_token, name=pod_name, spec=spec)
+        try:
+            if await pod.name() != pod_name:
+                raise Exception(f"Test failed: unexpected pod name {await pod.name()}")
+
+            # Load the pod into a fresh instance and check the bucket is there
+            service = dag.localstack().start(auth_token=auth_token)
+            await service.start()
+            endpoint = await service.endpoint(scheme="http")
+            await dag.localstack().state(auth_token=auth_token, load=pod_name, endpoint=endpoint)
+            output = await dag.localstack().awslocal(args=["s3", "ls"], endpoint=endpoint)
+            if "test-create-pod-bucket" not in output:
+                raise Exception(f"Test failed: bucket missing after loading the pod: {output}")
+        finally:
+            await dag.localstack().state(auth_token=auth_token, delete=pod_name)
+
+        return "Success: Cloud Pod created from spec"
+
+    @function
+    async def test_snapshot_restore(self, auth_token: dagger.Secret) -> str:
+        """Test if a snapshot brings back the state it was taken with"""
+        service = dag.localstack().start(auth_token=auth_token, persist=dag.directory())
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        await dag.localstack().awslocal(args=["s3", "mb", "s3://test-snapshot-bucket"], endpoint=endpoint)
+        snapshot = await dag.localstack().snapshot(service=service).sync()
+
+        await dag.localstack().awslocal(args=["s3", "rb", "s3://test-snapshot-bucket"], endpoint=endpoint)
+        endpoint = await dag.localstack().restore(service=service, snapshot=snapshot)
+
+        output = await dag.localstack().awslocal(args=["s3", "ls"], endpoint=endpoint)
+        if "test-snapshot-bucket" not in output:
+            raise Exception(f"Test failed: bucket missing after restore: {output}")
+
+        return "Success: Snapshot restored"
+
+    @function
+    async def test_send_sqs_message(self, auth_token: dagger.Secret) -> str:
+        """Test if a message sent to a queue can be received"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        queue_url = (await dag.localstack().awslocal(
+            args=["sqs", "create-queue", "--queue-name", "test-send-queue", "--query", "QueueUrl", "--output", "text"],
+            endpoint=endpoint,
+        )).strip()
+        message_id = await dag.localstack().send_sqs_message(queue_url=queue_url, body="hello", endpoint=endpoint)
+
+        received = await dag.localstack().awslocal(
+            args=["sqs", "receive-message", "--queue-url", queue_url, "--query", "Messages[0].MessageId", "--output", "text"],
+            endpoint=endpoint,
+        )
+        if received.strip() != message_id:
+            raise Exception(f"Test failed: received {received.strip()}, expected {message_id}")
+
+        return "Success: SQS message sent"
+
+    @function
+    async def test_services(self, auth_token: dagger.Secret) -> str:
+        """Test if the enabled services are listed"""
+        service = dag.localstack().start(auth_token=auth_token, services=["s3", "sqs"])
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        await dag.localstack().wait_for_services(services=["s3", "sqs"], endpoint=endpoint)
+        services = await dag.localstack().services(endpoint=endpoint)
+        missing = {"s3", "sqs"} - set(services)
+        if missing:
+            raise Exception(f"Test failed: services not listed: {', '.join(sorted(missing))}")
+
+        return "Success: Enabled services listed"
+
+    @function
+    async def test_create_execution_role(self, auth_token: dagger.Secret) -> str:
+        """Test if an execution role is created with its managed policies"""
+        service = dag.localstack().start(auth_token=auth_token)
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        policy_arn = "arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"
+        role_arn = await dag.localstack().create_execution_role(
+            name="test-execution-role",
+            policy_arns=[policy_arn],
+            endpoint=endpoint,
+        )
+        if not role_arn.endswith(":role/test-execution-role"):
+            raise Exception(f"Test failed: unexpected role ARN {role_arn}")
+
+        attached = await dag.localstack().awslocal(
+            args=["iam", "list-attached-role-policies", "--role-name", "test-execution-role", "--query", "AttachedPolicies[].PolicyArn", "--output", "text"],
+            endpoint=endpoint,
+        )
+        if policy_arn not in attached:
+            raise Exception(f"Test failed: {policy_arn} is not attached")
+
+        return "Success: Execution role created"
+
+    @function
+    async def test_attach(self, auth_token: dagger.Secret) -> str:
+        """Test if functions called on an attached handle use its endpoint"""
+        service = dag.localstack().start(auth_token=auth_token, services=["s3", "sqs"])
+        await service.start()
+        endpoint = await service.endpoint(scheme="http")
+
+        localstack = dag.localstack().attach(endpoint=endpoint)
+
+        if not await localstack.health().version():
+            raise Exception("Test failed: health of the attached instance is missing the version")
+
+        services = await localstack.services()
+        missing = {"s3", "sqs"} - set(services)
+        if missing:
+            raise Exception(f"Test failed: services not listed: {', '.join(sorted(missing))}")
+
+        await localstack.awslocal(args=["s3", "mb", "s3://test-attach-bucket"])
+        buckets = await localstack.awslocal(args=["s3", "ls"])
+        if "test-attach-bucket" not in buckets:
+            raise Exception("Test failed: bucket created through the attached handle not found")
+
+        return "Success: Functions run against the attached instance"